@@ -1,37 +1,117 @@
 package dagger
 
 import (
-	"bufio"
 	"bytes"
+	"context"
 	"fmt"
-	"io/ioutil"
 	"net/http"
-	"os/exec"
+	"os"
 	"regexp"
 	"strings"
 	"time"
 
-	"github.com/paketo-buildpacks/packit/pexec"
 	"github.com/pkg/errors"
 )
 
+const (
+	DefaultStartTimeout      = 2 * time.Minute
+	DefaultStartPollInterval = 1 * time.Second
+)
+
 type App struct {
-	ImageName   string
-	CacheImage  string
+	ImageName      string
+	CacheImage     string
+	ContainerID    string
+	Memory         string
+	RunOptions     RunOptions
+	Env            map[string]string
+	buildLogs      *bytes.Buffer
+	logFollower    *LogFollower
+	port           string
+	ports          []PortMapping
+	fixtureName    string
+	readiness      ReadinessCheck
+	startReadiness ReadinessCheck
+	runtime        ContainerRuntime
+	pack           *Pack
+	network        string
+	services       []*Service
+	volumes        []string
+	tempDirs       []string
+}
+
+// StartOptions configure how StartWithContext runs the app and waits for it
+// to become ready.
+type StartOptions struct {
+	// Command overrides the start command of the image.
+	Command string
+
+	// Timeout bounds how long to wait for the app to become ready.
+	// Defaults to DefaultStartTimeout.
+	Timeout time.Duration
+
+	// PollInterval is how often the readiness check is polled.
+	// Defaults to DefaultStartPollInterval.
+	PollInterval time.Duration
+
+	// Ports are container ports published in addition to $PORT, such as a
+	// management or metrics port. Use HostPort or URLFor to address them.
+	Ports []string
+
+	// Mounts are mounted into the app container. Volumes that do not exist
+	// yet are created, and removed again by Destroy.
+	Mounts []Mount
+
+	// Bindings are mounted at BindingRoot, which SERVICE_BINDING_ROOT is set
+	// to.
+	Bindings []Binding
+
+	// Readiness decides when the app is ready. Defaults to the check set with
+	// SetReadinessCheck or SetHealthCheck, and otherwise to HTTPReadiness("/", 0).
+	Readiness ReadinessCheck
+}
+
+// Health is the health check state docker reports for a container.
+type Health struct {
+	Status        string         `json:"Status"`
+	FailingStreak int            `json:"FailingStreak"`
+	Log           []HealthResult `json:"Log"`
+}
+
+// HealthResult is a single run of a container health check.
+type HealthResult struct {
+	Start    time.Time `json:"Start"`
+	End      time.Time `json:"End"`
+	ExitCode int       `json:"ExitCode"`
+	Output   string    `json:"Output"`
+}
+
+// StartError is returned when an app container does not become ready.
+type StartError struct {
+	Fixture     string
 	ContainerID string
-	Memory      string
-	Env         map[string]string
-	buildLogs   *bytes.Buffer
-	logProc     *exec.Cmd
-	port        string
-	fixtureName string
-	healthCheck HealthCheck
+	Logs        string
+	HealthLog   []HealthResult
+	Err         error
+}
+
+func (e *StartError) Error() string {
+	message := &strings.Builder{}
+	fmt.Fprintf(message, "%s\n", e.Err)
+
+	if len(e.HealthLog) > 0 {
+		fmt.Fprintln(message, "health check history:")
+		for _, result := range e.HealthLog {
+			fmt.Fprintf(message, "  [%s] exit code %d: %s\n", result.Start.Format(time.RFC3339), result.ExitCode, strings.TrimSpace(result.Output))
+		}
+	}
+
+	fmt.Fprintf(message, "container logs:\n%s", e.Logs)
+	return message.String()
 }
 
-type HealthCheck struct {
-	command  string
-	interval string
-	timeout  string
+func (e *StartError) Unwrap() error {
+	return e.Err
 }
 
 func NewApp(fixturePath, imageName, cacheImage string, buildLogs *bytes.Buffer, env map[string]string) App {
@@ -49,117 +129,244 @@ func (a *App) Start() error {
 }
 
 func (a *App) StartWithCommand(startCmd string) error {
+	return a.StartWithContext(context.Background(), StartOptions{Command: startCmd})
+}
+
+// StartWithContext runs the app image and waits for its readiness check to
+// pass. If the context is cancelled or the timeout expires before then, the
+// container is stopped and a *StartError carrying its logs and health check
+// history is returned.
+func (a *App) StartWithContext(ctx context.Context, options StartOptions) error {
+	if options.Timeout == 0 {
+		options.Timeout = DefaultStartTimeout
+	}
+
+	if options.PollInterval == 0 {
+		options.PollInterval = DefaultStartPollInterval
+	}
+
+	if a.Env == nil {
+		a.Env = map[string]string{}
+	}
+
 	if a.Env["PORT"] == "" {
 		a.Env["PORT"] = "8080"
 	}
 
-	args := []string{"run", "-d", "-p", a.Env["PORT"], "-P"}
-	if a.Memory != "" {
-		args = append(args, "--memory", a.Memory)
+	if len(options.Bindings) > 0 {
+		bindingsDir, err := writeBindings(options.Bindings)
+		if err != nil {
+			return err
+		}
+		a.tempDirs = append(a.tempDirs, bindingsDir)
+
+		options.Mounts = append(options.Mounts, Mount{
+			Type:     MountTypeBind,
+			Source:   bindingsDir,
+			Target:   BindingRoot,
+			ReadOnly: true,
+		})
+		a.Env["SERVICE_BINDING_ROOT"] = BindingRoot
+	}
+
+	readiness := options.Readiness
+	if readiness == nil {
+		readiness = a.readiness
 	}
 
-	if a.healthCheck.command == "" {
-		a.healthCheck.command = fmt.Sprintf("curl --fail http://localhost:%s || exit 1", a.Env["PORT"])
+	if readiness == nil {
+		readiness = HTTPReadiness("/", 0)
 	}
-	args = append(args, "--health-cmd", a.healthCheck.command)
 
-	if a.healthCheck.interval != "" {
-		args = append(args, "--health-interval", a.healthCheck.interval)
+	config, err := a.runConfig(options, readiness)
+	if err != nil {
+		return err
 	}
+	a.startReadiness = readiness
 
-	if a.healthCheck.timeout != "" {
-		args = append(args, "--health-timeout", a.healthCheck.timeout)
+	runtime, err := a.containerRuntime()
+	if err != nil {
+		return err
 	}
 
-	envTemplate := "%s=%s"
-	for k, v := range a.Env {
-		envString := fmt.Sprintf(envTemplate, k, v)
-		args = append(args, "-e", envString)
+	var volumes []string
+	for _, mount := range config.Mounts {
+		if mount.Type != MountTypeVolume {
+			continue
+		}
+
+		exists, err := runtime.Exists(ctx, mount.Source)
+		if err != nil {
+			return fmt.Errorf("failed to find volume %s: %w", mount.Source, err)
+		}
+
+		if !exists {
+			volumes = append(volumes, mount.Source)
+		}
 	}
 
-	args = append(args, a.ImageName)
-	if startCmd != "" {
-		args = append(args, startCmd)
+	a.ContainerID, err = runtime.Run(ctx, config)
+	if err != nil {
+		// The volumes may have been created along with a container that then
+		// failed to start, or not at all, so Destroy is not left to find out
+		for _, volume := range volumes {
+			_ = runtime.RemoveVolume(context.Background(), volume)
+		}
+
+		return errors.Wrap(err, fmt.Sprintf("failed to run image: %s\n with command: %s", a.ImageName, config.Command))
 	}
+	a.volumes = append(a.volumes, volumes...)
 
-	docker := pexec.NewExecutable("docker")
-	stdout := bytes.NewBuffer(nil)
-	err := docker.Execute(pexec.Execution{
-		Args:   args,
-		Stdout: stdout,
-	})
+	a.ports, err = runtime.Ports(ctx, a.ContainerID)
+	if err != nil {
+		return a.startFailure(nil, errors.Wrap(err, fmt.Sprintf("failed to get port from container: %s", a.ContainerID)))
+	}
 
+	a.port, err = a.HostPort(a.Env["PORT"])
 	if err != nil {
-		return errors.Wrap(err, fmt.Sprintf("failed to run docker image: %s\n with command: %s", a.ImageName, args))
+		return a.startFailure(nil, err)
 	}
 
-	a.ContainerID = stdout.String()[:12]
+	return a.waitUntilReady(ctx, runtime, readiness, options.Timeout, options.PollInterval)
+}
+
+// waitUntilReady polls the started container until readiness passes, and
+// stops it if it exits, the timeout expires or the context is cancelled.
+func (a *App) waitUntilReady(ctx context.Context, runtime ContainerRuntime, readiness ReadinessCheck, timeout, pollInterval time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
 
-	ticker := time.NewTicker(1 * time.Second)
-	timeOut := time.After(2 * time.Minute)
-docker:
+	var (
+		state ContainerState
+		err   error
+	)
 	for {
 		select {
 		case <-ticker.C:
-			health, err := exec.Command("docker", "inspect", "-f", "{{.State.Health}}", a.ContainerID).CombinedOutput()
+			state, err = runtime.Inspect(ctx, a.ContainerID)
+			if err != nil && ctx.Err() != nil {
+				continue
+			}
+
 			if err != nil {
-				return errors.Wrap(err, fmt.Sprintf("failed to docker inspect health of container: %s\n with health status: %s\n", a.ContainerID, string(health)))
+				return a.startFailure(nil, errors.Wrap(err, fmt.Sprintf("failed to inspect container: %s", a.ContainerID)))
 			}
 
-			status := strings.TrimSuffix(string(health), "\n")
-			if status != "<nil>" {
-				// Split string by space and remove curly brace in front
-				status = strings.Split(string(status), " ")[0][1:]
-				status = strings.TrimSpace(status)
+			if !state.Running {
+				return a.startFailure(state.Health, fmt.Errorf("app exited with code %d before becoming ready: %s", state.ExitCode, a.fixtureName))
 			}
 
-			if status == "unhealthy" {
-				logs, _ := a.Logs()
-				return errors.Errorf("app failed to start: %s\n%s\n", a.fixtureName, logs)
+			ready, err := readiness.Check(ctx, a)
+			if err != nil && ctx.Err() != nil {
+				continue
+			}
+
+			if err != nil {
+				return a.startFailure(state.Health, err)
 			}
 
-			if status == "healthy" || status == "<nil>" {
-				break docker
+			if ready {
+				return nil
 			}
-		case <-timeOut:
-			return fmt.Errorf("timed out waiting for app : %s", a.fixtureName)
+		case <-ctx.Done():
+			if ctx.Err() == context.DeadlineExceeded {
+				return a.startFailure(state.Health, fmt.Errorf("timed out after %s waiting for app: %s", timeout, a.fixtureName))
+			}
+
+			return a.startFailure(state.Health, fmt.Errorf("cancelled while waiting for app: %s: %w", a.fixtureName, ctx.Err()))
 		}
 	}
+}
 
-	stdout = bytes.NewBuffer(nil)
-	err = docker.Execute(pexec.Execution{
-		Args:   []string{"container", "port", a.ContainerID},
-		Stdout: stdout,
-	})
+func (a *App) runConfig(options StartOptions, readiness ReadinessCheck) (RunConfig, error) {
+	err := a.RunOptions.Validate()
 	if err != nil {
-		return errors.Wrap(err, fmt.Sprintf("docker error: failed to get port from container: %s", a.ContainerID))
-	}
-
-	ipv4PortMapping := ""
-	scanner := bufio.NewScanner(strings.NewReader(stdout.String()))
-	for scanner.Scan() {
-		mapping := scanner.Text()
-		// filter out ipv6
-		// Docker 20.10.6 includes IPv6 port-mappings.
-		// https://docs.docker.com/engine/release-notes/#version-2010
-		if !strings.Contains(mapping, "::") {
-			ipv4PortMapping = mapping
+		return RunConfig{}, err
+	}
+
+	if a.Memory != "" {
+		_, err = parseMemory(a.Memory)
+		if err != nil {
+			return RunConfig{}, err
 		}
 	}
 
-	if ipv4PortMapping == "" {
-		return fmt.Errorf("unable to get port map from docker")
+	config := RunConfig{
+		Image:   a.ImageName,
+		Env:     a.Env,
+		Ports:   []string{a.Env["PORT"]},
+		Memory:  a.Memory,
+		Options: a.RunOptions,
+		Network: a.network,
 	}
 
-	ports := strings.Split(ipv4PortMapping, ":")
+	for _, port := range options.Ports {
+		if tcpPort(port) != tcpPort(a.Env["PORT"]) {
+			config.Ports = append(config.Ports, port)
+		}
+	}
 
-	if len(ports) > 1 {
-		a.port = strings.TrimSpace(ports[1])
-	} else {
-		return fmt.Errorf("unable to get port map from docker")
+	if options.Command != "" {
+		config.Command = []string{options.Command}
 	}
 
-	return nil
+	config.Mounts, err = resolveMounts(options.Mounts, a.RunOptions.Tmpfs)
+	if err != nil {
+		return RunConfig{}, err
+	}
+
+	if configurer, ok := readiness.(runConfigurer); ok {
+		err = configurer.configure(a, &config)
+		if err != nil {
+			return RunConfig{}, err
+		}
+	}
+
+	return config, nil
+}
+
+// startFailure stops the half-started app container and collects what is
+// needed to debug why it never became ready.
+func (a *App) startFailure(health *Health, cause error) error {
+	startErr := &StartError{
+		Fixture:     a.fixtureName,
+		ContainerID: a.ContainerID,
+		Err:         cause,
+	}
+
+	if health != nil {
+		startErr.HealthLog = health.Log
+	}
+
+	startErr.Logs, _ = a.Logs()
+
+	err := a.runtime.Stop(context.Background(), a.ContainerID)
+	if err != nil {
+		startErr.Err = fmt.Errorf("%s (failed to stop container: %s)", startErr.Err, err)
+	}
+
+	return startErr
+}
+
+// SetContainerRuntime overrides the runtime picked from
+// $DAGGER_CONTAINER_RUNTIME.
+func (a *App) SetContainerRuntime(runtime ContainerRuntime) {
+	a.runtime = runtime
+}
+
+func (a *App) containerRuntime() (ContainerRuntime, error) {
+	if a.runtime == nil {
+		runtime, err := NewContainerRuntime("")
+		if err != nil {
+			return nil, err
+		}
+		a.runtime = runtime
+	}
+
+	return a.runtime, nil
 }
 
 func (a *App) Destroy() error {
@@ -167,144 +374,131 @@ func (a *App) Destroy() error {
 		return nil
 	}
 
-	docker := pexec.NewExecutable("docker")
+	if a.logFollower != nil {
+		a.logFollower.Stop()
+	}
 
-	cntrExists, err := DockerArtifactExists(a.ContainerID)
+	ctx := context.Background()
+	runtime, err := a.containerRuntime()
+	if err != nil {
+		return err
+	}
+
+	err = a.destroyServices(ctx, runtime)
+	if err != nil {
+		return err
+	}
+
+	cntrExists, err := runtime.Exists(ctx, a.ContainerID)
 	if err != nil {
 		return fmt.Errorf("failed to find container %s: %s", a.ContainerID, err)
 	}
 
 	if cntrExists {
-		err := docker.Execute(pexec.Execution{
-			Args: []string{"stop", a.ContainerID},
-		})
+		err := runtime.Stop(ctx, a.ContainerID)
 		if err != nil {
 			return fmt.Errorf("failed to stop container %s: %s", a.ContainerID, err)
 		}
 
-		err = docker.Execute(pexec.Execution{
-			Args: []string{"rm", a.ContainerID, "-f", "--volumes"},
-		})
+		err = runtime.Remove(ctx, a.ContainerID)
 		if err != nil {
 			return fmt.Errorf("failed to remove container %s: %s", a.ContainerID, err)
 		}
 	}
 
-	imgExists, err := DockerArtifactExists(a.ImageName)
-	if err != nil {
-		return fmt.Errorf("failed to find image %s: %s", a.ImageName, err)
-	}
-
-	if imgExists {
-		err = docker.Execute(pexec.Execution{
-			Args: []string{"rmi", a.ImageName, "-f"},
-		})
+	for _, volume := range a.volumes {
+		err = runtime.RemoveVolume(ctx, volume)
 		if err != nil {
-			return fmt.Errorf("failed to remove image %s: %s", a.ImageName, err)
+			return fmt.Errorf("failed to remove volume %s: %s", volume, err)
 		}
 	}
 
-	cacheExists, err := DockerArtifactExists(a.CacheImage)
-	if err != nil {
-		return fmt.Errorf("failed to find cache image %s: %s", a.CacheImage, err)
+	if a.network != "" {
+		err = runtime.RemoveNetwork(ctx, a.network)
+		if err != nil {
+			return err
+		}
 	}
 
-	if cacheExists {
-		err = docker.Execute(pexec.Execution{
-			Args: []string{"rmi", a.CacheImage, "-f"},
-		})
+	for _, image := range []string{a.ImageName, a.CacheImage} {
+		exists, err := runtime.Exists(ctx, image)
 		if err != nil {
-			return fmt.Errorf("failed to remove cache image %s: %s", a.CacheImage, err)
+			return fmt.Errorf("failed to find image %s: %s", image, err)
 		}
-	}
 
-	cacheBuildVolumeExists, err := DockerArtifactExists(fmt.Sprintf("%s.build", a.CacheImage))
-	if err != nil {
-		return fmt.Errorf("failed to find cache build volume %s.build: %s", a.CacheImage, err)
+		if exists {
+			err = runtime.RemoveImage(ctx, image)
+			if err != nil {
+				return fmt.Errorf("failed to remove image %s: %s", image, err)
+			}
+		}
 	}
 
-	if cacheBuildVolumeExists {
-		err = docker.Execute(pexec.Execution{
-			Args: []string{"volume", "rm", fmt.Sprintf("%s.build", a.CacheImage)},
-		})
+	for _, volume := range []string{fmt.Sprintf("%s.build", a.CacheImage), fmt.Sprintf("%s.launch", a.CacheImage)} {
+		exists, err := runtime.Exists(ctx, volume)
 		if err != nil {
-			return fmt.Errorf("failed to remove cache build volume %s.build: %s", a.CacheImage, err)
+			return fmt.Errorf("failed to find cache volume %s: %s", volume, err)
+		}
+
+		if exists {
+			err = runtime.RemoveVolume(ctx, volume)
+			if err != nil {
+				return fmt.Errorf("failed to remove cache volume %s: %s", volume, err)
+			}
 		}
 	}
 
-	cacheLaunchVolumeExists, err := DockerArtifactExists(fmt.Sprintf("%s.launch", a.CacheImage))
+	err = runtime.PruneImages(ctx)
 	if err != nil {
-		return fmt.Errorf("failed to find cache launch volume %s.launch: %s", a.CacheImage, err)
+		return fmt.Errorf("failed to prune images: %s", err)
 	}
 
-	if cacheLaunchVolumeExists {
-		err = docker.Execute(pexec.Execution{
-			Args: []string{"volume", "rm", fmt.Sprintf("%s.launch", a.CacheImage)},
-		})
+	for _, dir := range a.tempDirs {
+		err = os.RemoveAll(dir)
 		if err != nil {
-			return fmt.Errorf("failed to remove cache launch volume %s.launch: %s", a.CacheImage, err)
+			return err
 		}
 	}
 
-	err = docker.Execute(pexec.Execution{
-		Args: []string{"image", "prune", "-f"},
-	})
-	if err != nil {
-		return fmt.Errorf("failed to prune images: %s", err)
-	}
-
 	*a = App{}
 	return nil
 }
 
 func (a *App) Logs() (string, error) {
-	docker := pexec.NewExecutable("docker")
-	buffer := bytes.NewBuffer(nil)
-	err := docker.Execute(pexec.Execution{
-		Args:   []string{"logs", a.ContainerID},
-		Stdout: buffer,
-		Stderr: buffer,
-	})
+	runtime, err := a.containerRuntime()
 	if err != nil {
 		return "", err
 	}
 
-	return stripColor(buffer.String()), nil
+	logs, err := runtime.Logs(context.Background(), a.ContainerID)
+	if err != nil {
+		return "", err
+	}
+
+	return stripColor(logs), nil
 }
 
 func (a *App) BuildLogs() string {
 	return stripColor(a.buildLogs.String())
 }
 
+// SetHealthCheck makes the app wait for a HEALTHCHECK command run inside the
+// container, see DockerHealthCheck.
 func (a *App) SetHealthCheck(command, interval, timeout string) {
-	a.healthCheck = HealthCheck{
-		command:  command,
-		interval: interval,
-		timeout:  timeout,
-	}
+	a.readiness = DockerHealthCheck(command, interval, timeout)
 }
 
-func (a *App) Files(path string) ([]string, error) {
-	// Ensures that the error and results from "Permission denied" don't get sent to the output
-	docker := pexec.NewExecutable("docker")
-	stdout := bytes.NewBuffer(nil)
-
-	err := docker.Execute(pexec.Execution{
-		Args: []string{
-			"run", a.ImageName,
-			"find", "./..", fmt.Sprintf("-wholename *%s* 2>&1 | grep -v \"Permission denied\"", path),
-		},
-		Stdout: stdout,
-	})
-	if err != nil {
-		return []string{}, err
-	}
-
-	return strings.Split(stdout.String(), "\n"), nil
+func (a *App) SetReadinessCheck(readiness ReadinessCheck) {
+	a.readiness = readiness
 }
 
 func (a *App) Info() (cID string, imageID string, cacheID []string, e error) {
-	volumes, err := getCacheVolumes()
+	runtime, err := a.containerRuntime()
+	if err != nil {
+		return "", "", []string{}, err
+	}
+
+	volumes, err := getCacheVolumes(runtime)
 	if err != nil {
 		return "", "", []string{}, err
 	}
@@ -316,24 +510,67 @@ func (a App) GetBaseURL() string {
 	return fmt.Sprintf("http://localhost:%s", a.port)
 }
 
-func (a *App) HTTPGet(path string) (string, map[string][]string, error) {
-	resp, err := http.Get(fmt.Sprintf("%s%s", a.GetBaseURL(), path))
+// HostPort returns the host port that containerPort is published on. IPv4
+// bindings are preferred, IPv6 ones are used when they are all there is.
+func (a *App) HostPort(containerPort string) (string, error) {
+	mapping, err := a.portMapping(containerPort)
 	if err != nil {
-		return "", nil, err
+		return "", err
 	}
 
-	defer resp.Body.Close()
+	return mapping.HostPort, nil
+}
 
-	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		return "", nil, fmt.Errorf("received bad response from application")
+// URLFor returns the base URL at which containerPort can be reached from the
+// host.
+func (a *App) URLFor(containerPort string) (string, error) {
+	mapping, err := a.portMapping(containerPort)
+	if err != nil {
+		return "", err
 	}
 
-	body, err := ioutil.ReadAll(resp.Body)
+	if strings.Contains(mapping.HostIP, ":") {
+		return fmt.Sprintf("http://[::1]:%s", mapping.HostPort), nil
+	}
+
+	return fmt.Sprintf("http://localhost:%s", mapping.HostPort), nil
+}
+
+func (a *App) portMapping(containerPort string) (PortMapping, error) {
+	var ipv6Mapping *PortMapping
+	for _, mapping := range a.ports {
+		if mapping.ContainerPort != tcpPort(containerPort) {
+			continue
+		}
+
+		if !strings.Contains(mapping.HostIP, ":") {
+			return mapping, nil
+		}
+
+		if ipv6Mapping == nil {
+			m := mapping
+			ipv6Mapping = &m
+		}
+	}
+
+	if ipv6Mapping != nil {
+		return *ipv6Mapping, nil
+	}
+
+	return PortMapping{}, fmt.Errorf("unable to get port map for container port %s of container %s, it may need to be added to StartOptions.Ports", containerPort, a.ContainerID)
+}
+
+func (a *App) HTTPGet(path string) (string, map[string][]string, error) {
+	resp, err := a.Request(http.MethodGet, path).Do()
 	if err != nil {
 		return "", nil, err
 	}
 
-	return string(body), resp.Header, nil
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return "", nil, &BadResponseError{Response: resp}
+	}
+
+	return resp.Body, resp.Header, nil
 }
 
 func (a *App) HTTPGetBody(path string) (string, error) {
@@ -348,41 +585,26 @@ func stripColor(input string) string {
 	return re.ReplaceAllString(input, "")
 }
 
-func getCacheVolumes() ([]string, error) {
-	docker := pexec.NewExecutable("docker")
-	stdout := bytes.NewBuffer(nil)
-	err := docker.Execute(pexec.Execution{
-		Args:   []string{"volume", "ls", "-q"},
-		Stdout: stdout,
-	})
+func getCacheVolumes(runtime ContainerRuntime) ([]string, error) {
+	volumes, err := runtime.Volumes(context.Background())
 	if err != nil {
 		return []string{}, err
 	}
 
-	outputArr := strings.Split(stdout.String(), "\n")
 	var finalVolumes []string
-	for _, line := range outputArr {
-		if strings.Contains(line, "pack-cache") {
-			finalVolumes = append(finalVolumes, line)
+	for _, volume := range volumes {
+		if strings.Contains(volume, "pack-cache") {
+			finalVolumes = append(finalVolumes, volume)
 		}
 	}
-	return outputArr, nil
+	return finalVolumes, nil
 }
 
 func DockerArtifactExists(name string) (bool, error) {
-	docker := pexec.NewExecutable("docker")
-	stderr := bytes.NewBuffer(nil)
-	err := docker.Execute(pexec.Execution{
-		Args:   []string{"inspect", name},
-		Stderr: stderr,
-	})
+	docker, err := NewDockerClient("")
 	if err != nil {
-		if strings.Contains(stderr.String(), "No such object") {
-			return false, nil
-		}
-
 		return false, err
 	}
 
-	return true, nil
+	return docker.Exists(context.Background(), name)
 }
@@ -0,0 +1,183 @@
+package dagger_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/cloudfoundry/dagger"
+	fakes "github.com/cloudfoundry/dagger/fakes/runtime"
+	"github.com/sclevine/spec"
+
+	. "github.com/onsi/gomega"
+)
+
+func testApp(t *testing.T, when spec.G, it spec.S) {
+	var (
+		app      dagger.App
+		runtime  *fakes.ContainerRuntime
+		notReady dagger.ReadinessFunc
+	)
+
+	it.Before(func() {
+		runtime = &fakes.ContainerRuntime{
+			ContainerID:   "app-id",
+			State:         dagger.ContainerState{Status: "running", Running: true},
+			ContainerLogs: "Booting...\n",
+			PortMappings:  []dagger.PortMapping{{ContainerPort: "8080/tcp", HostIP: "0.0.0.0", HostPort: "40000"}},
+		}
+
+		app = dagger.NewApp("some-fixture", "some-image", "some-cache", nil, nil)
+		app.SetContainerRuntime(runtime)
+
+		notReady = func(context.Context, *dagger.App) (bool, error) {
+			return false, nil
+		}
+	})
+
+	when("starting an app", func() {
+		it("polls the readiness check at the poll interval until it passes", func() {
+			var checks int
+			err := app.StartWithContext(context.Background(), dagger.StartOptions{
+				Readiness: dagger.ReadinessFunc(func(context.Context, *dagger.App) (bool, error) {
+					checks++
+					return checks == 3, nil
+				}),
+				PollInterval: 10 * time.Millisecond,
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(checks).To(Equal(3))
+			Expect(runtime.Inspected).To(Equal([]string{"app-id", "app-id", "app-id"}))
+			Expect(runtime.Stopped).To(BeEmpty())
+			Expect(app.GetBaseURL()).To(Equal("http://localhost:40000"))
+		})
+
+		it("stops the container once the timeout expires", func() {
+			started := time.Now()
+			err := app.StartWithContext(context.Background(), dagger.StartOptions{
+				Readiness:    notReady,
+				Timeout:      100 * time.Millisecond,
+				PollInterval: 10 * time.Millisecond,
+			})
+			Expect(time.Since(started)).To(BeNumerically("<", time.Second))
+
+			var startErr *dagger.StartError
+			Expect(errors.As(err, &startErr)).To(BeTrue())
+			Expect(startErr.Err).To(MatchError("timed out after 100ms waiting for app: some-fixture"))
+			Expect(runtime.Stopped).To(Equal([]string{"app-id"}))
+		})
+
+		it("stops the container when the context is cancelled", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			time.AfterFunc(50*time.Millisecond, cancel)
+
+			err := app.StartWithContext(ctx, dagger.StartOptions{
+				Readiness:    notReady,
+				PollInterval: 10 * time.Millisecond,
+			})
+			Expect(errors.Is(err, context.Canceled)).To(BeTrue())
+			Expect(err).To(MatchError(ContainSubstring("cancelled while waiting for app: some-fixture")))
+			Expect(runtime.Stopped).To(Equal([]string{"app-id"}))
+		})
+
+		it("fails as soon as the container exits", func() {
+			runtime.State = dagger.ContainerState{Status: "exited", ExitCode: 3}
+
+			err := app.StartWithContext(context.Background(), dagger.StartOptions{
+				Readiness:    notReady,
+				PollInterval: 10 * time.Millisecond,
+			})
+			Expect(err).To(MatchError(ContainSubstring("app exited with code 3 before becoming ready: some-fixture")))
+			Expect(runtime.Inspected).To(HaveLen(1))
+		})
+
+		it("reports the logs and health check history of the container", func() {
+			started := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+			runtime.State.Health = &dagger.Health{
+				Status: "unhealthy",
+				Log: []dagger.HealthResult{
+					{Start: started, ExitCode: 1, Output: "curl: (7) Failed to connect\n"},
+				},
+			}
+
+			err := app.StartWithContext(context.Background(), dagger.StartOptions{
+				Readiness:    dagger.DockerHealthCheck("", "", ""),
+				PollInterval: 10 * time.Millisecond,
+			})
+
+			var startErr *dagger.StartError
+			Expect(errors.As(err, &startErr)).To(BeTrue())
+			Expect(startErr.Fixture).To(Equal("some-fixture"))
+			Expect(startErr.ContainerID).To(Equal("app-id"))
+			Expect(startErr.Logs).To(Equal("Booting...\n"))
+			Expect(startErr.HealthLog).To(Equal(runtime.State.Health.Log))
+			Expect(startErr.Err).To(MatchError("app failed to start: some-fixture"))
+
+			Expect(err.Error()).To(Equal("app failed to start: some-fixture\n" +
+				"health check history:\n" +
+				"  [2020-01-02T03:04:05Z] exit code 1: curl: (7) Failed to connect\n" +
+				"container logs:\nBooting...\n"))
+		})
+
+		it("stops the container when its ports cannot be found", func() {
+			runtime.PortsStub = func(context.Context, string) ([]dagger.PortMapping, error) {
+				return nil, errors.New("some-error")
+			}
+
+			err := app.StartWithContext(context.Background(), dagger.StartOptions{Readiness: notReady})
+			Expect(err).To(MatchError(ContainSubstring("failed to get port from container: app-id: some-error")))
+			Expect(runtime.Stopped).To(Equal([]string{"app-id"}))
+		})
+
+		it("stops the container when $PORT is not published", func() {
+			runtime.PortMappings = nil
+
+			err := app.StartWithContext(context.Background(), dagger.StartOptions{Readiness: notReady})
+			Expect(err).To(MatchError(ContainSubstring("unable to get port map for container port 8080 of container app-id")))
+			Expect(runtime.Stopped).To(Equal([]string{"app-id"}))
+		})
+	})
+
+	when("looking up published ports", func() {
+		it.Before(func() {
+			runtime.PortMappings = []dagger.PortMapping{
+				{ContainerPort: "8080/tcp", HostIP: "::", HostPort: "40001"},
+				{ContainerPort: "8080/tcp", HostIP: "0.0.0.0", HostPort: "40000"},
+				{ContainerPort: "9090/tcp", HostIP: "::", HostPort: "40002"},
+			}
+
+			Expect(app.StartWithContext(context.Background(), dagger.StartOptions{
+				Ports: []string{"8080", "9090"},
+				Readiness: dagger.ReadinessFunc(func(context.Context, *dagger.App) (bool, error) {
+					return true, nil
+				}),
+				PollInterval: time.Millisecond,
+			})).To(Succeed())
+		})
+
+		it("publishes $PORT once along with the extra ports", func() {
+			Expect(runtime.Runs[0].Ports).To(Equal([]string{"8080", "9090"}))
+		})
+
+		it("prefers IPv4 bindings", func() {
+			Expect(app.HostPort("8080")).To(Equal("40000"))
+			Expect(app.URLFor("8080")).To(Equal("http://localhost:40000"))
+			Expect(app.GetBaseURL()).To(Equal("http://localhost:40000"))
+		})
+
+		it("falls back to IPv6 bindings", func() {
+			Expect(app.HostPort("9090")).To(Equal("40002"))
+			Expect(app.URLFor("9090")).To(Equal("http://[::1]:40002"))
+		})
+
+		it("fails for ports that are not published", func() {
+			_, err := app.HostPort("7070")
+			Expect(err).To(MatchError("unable to get port map for container port 7070 of container app-id, it may need to be added to StartOptions.Ports"))
+
+			_, err = app.URLFor("7070")
+			Expect(err).To(HaveOccurred())
+		})
+	})
+}
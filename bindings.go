@@ -0,0 +1,98 @@
+package dagger
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// BindingRoot is where bindings are mounted in build and app containers,
+// and what SERVICE_BINDING_ROOT points at.
+const BindingRoot = "/platform/bindings"
+
+// Binding is a service binding as described by the CNB and Kubernetes service
+// binding specs: a directory holding a type file and one file per entry.
+type Binding struct {
+	Name    string
+	Type    string
+	Entries map[string]string
+}
+
+// SetBinding adds a binding that buildpacks see during the build.
+func SetBinding(name, bindingType string, entries map[string]string) PackOption {
+	return func(pack Pack) Pack {
+		pack.bindings = append(pack.bindings, Binding{
+			Name:    name,
+			Type:    bindingType,
+			Entries: entries,
+		})
+		return pack
+	}
+}
+
+// writeBindings writes bindings to a new temporary directory, laid out as
+// $SERVICE_BINDING_ROOT expects, which the caller removes when done.
+func writeBindings(bindings []Binding) (string, error) {
+	dir, err := ioutil.TempDir("", "bindings")
+	if err != nil {
+		return "", err
+	}
+
+	// Build and app containers do not run as the user who owns the directory
+	err = os.Chmod(dir, 0755)
+	if err != nil {
+		os.RemoveAll(dir)
+		return "", err
+	}
+
+	for _, binding := range bindings {
+		err = writeBinding(dir, binding)
+		if err != nil {
+			os.RemoveAll(dir)
+			return "", err
+		}
+	}
+
+	return dir, nil
+}
+
+func writeBinding(dir string, binding Binding) error {
+	if binding.Name == "" || binding.Type == "" {
+		return fmt.Errorf("binding requires a name and a type")
+	}
+
+	if filepath.Base(binding.Name) != binding.Name {
+		return fmt.Errorf("invalid binding name %q", binding.Name)
+	}
+
+	bindingDir := filepath.Join(dir, binding.Name)
+	err := os.Mkdir(bindingDir, 0755)
+	if err != nil {
+		return fmt.Errorf("binding %s is set more than once: %w", binding.Name, err)
+	}
+
+	files := map[string]string{"type": binding.Type}
+	for key, value := range binding.Entries {
+		if filepath.Base(key) != key || key == "type" {
+			return fmt.Errorf("invalid entry %q of binding %s", key, binding.Name)
+		}
+		files[key] = value
+	}
+
+	var names []string
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		err = ioutil.WriteFile(filepath.Join(bindingDir, name), []byte(files[name]), 0644)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,138 @@
+package dagger
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/cloudfoundry/dagger/utils"
+	"github.com/paketo-buildpacks/packit/pexec"
+)
+
+// BuilderSpec describes a builder, and is written out as its builder.toml.
+type BuilderSpec struct {
+	Description string                `toml:"description,omitempty"`
+	Buildpacks  []BuilderBuildpack    `toml:"buildpacks"`
+	Order       []BuilderOrderGroup   `toml:"order"`
+	Stack       BuilderStack          `toml:"stack"`
+	Lifecycle   *BuilderLifecycleSpec `toml:"lifecycle,omitempty"`
+}
+
+// BuilderBuildpack is a buildpack to include in the builder. URI is a local
+// directory or archive, or an image reference such as docker://some-image.
+type BuilderBuildpack struct {
+	ID      string `toml:"id,omitempty"`
+	Version string `toml:"version,omitempty"`
+	URI     string `toml:"uri"`
+}
+
+type BuilderOrderGroup struct {
+	Group []BuilderGroupEntry `toml:"group"`
+}
+
+type BuilderGroupEntry struct {
+	ID       string `toml:"id"`
+	Version  string `toml:"version,omitempty"`
+	Optional bool   `toml:"optional,omitempty"`
+}
+
+type BuilderStack struct {
+	ID              string   `toml:"id"`
+	BuildImage      string   `toml:"build-image"`
+	RunImage        string   `toml:"run-image"`
+	RunImageMirrors []string `toml:"run-image-mirrors,omitempty"`
+}
+
+// BuilderLifecycleSpec picks the lifecycle of the builder. Leave it nil for
+// the one pack defaults to.
+type BuilderLifecycleSpec struct {
+	Version string `toml:"version,omitempty"`
+	URI     string `toml:"uri,omitempty"`
+}
+
+// Builder is a builder image created by CreateBuilder. Pass its Image to
+// SetBuilder to build with it, and call Remove once done with it.
+type Builder struct {
+	Image string
+	Logs  string
+}
+
+// CreateBuilder creates a builder image with a random name from spec, using
+// `pack builder create`, or `pack create-builder` on pack releases before
+// 0.15.0.
+// Relative buildpack paths are resolved against the working directory.
+// Nothing removes the builder image for you: callers must call Remove, such
+// as in the it.After or the deferred teardown of the tests that use it.
+func CreateBuilder(spec BuilderSpec) (*Builder, error) {
+	spec.Buildpacks = append([]BuilderBuildpack{}, spec.Buildpacks...)
+	for i, buildpack := range spec.Buildpacks {
+		if buildpack.URI != "" && !strings.Contains(buildpack.URI, "://") {
+			uri, err := filepath.Abs(buildpack.URI)
+			if err != nil {
+				return nil, err
+			}
+			spec.Buildpacks[i].URI = uri
+		}
+	}
+
+	dir, err := ioutil.TempDir("", "builder")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	configPath := filepath.Join(dir, "builder.toml")
+	file, err := os.Create(configPath)
+	if err != nil {
+		return nil, err
+	}
+
+	err = toml.NewEncoder(file).Encode(spec)
+	file.Close()
+	if err != nil {
+		return nil, fmt.Errorf("failed to write builder.toml: %w", err)
+	}
+
+	image := fmt.Sprintf("dagger-builder-%s", utils.RandStringRunes(12))
+	executable := newGroupExecutable("pack")
+
+	version, err := installedPackVersion(executable)
+	if err != nil {
+		return nil, err
+	}
+
+	args := []string{"create-builder", image, "--builder-config", configPath}
+	if version.atLeast(packBuilderCreateVersion) {
+		args = []string{"builder", "create", image, "--config", configPath}
+	}
+
+	logs := bytes.NewBuffer(nil)
+	err = executable.Execute(pexec.Execution{
+		Args:   args,
+		Stdout: logs,
+		Stderr: logs,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create builder with output:\n%s\n--> error message: %w", logs, err)
+	}
+
+	return &Builder{
+		Image: image,
+		Logs:  logs.String(),
+	}, nil
+}
+
+// Remove removes the builder image.
+func (b *Builder) Remove() error {
+	runtime, err := NewContainerRuntime("")
+	if err != nil {
+		return err
+	}
+
+	return runtime.RemoveImage(context.Background(), b.Image)
+}
@@ -0,0 +1,124 @@
+package dagger_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/cloudfoundry/dagger"
+	"github.com/sclevine/spec"
+
+	. "github.com/onsi/gomega"
+)
+
+func testBuilder(t *testing.T, when spec.G, it spec.S) {
+	it("creates a builder from builder.toml", func() {
+		builder, err := dagger.CreateBuilder(dagger.BuilderSpec{
+			Buildpacks: []dagger.BuilderBuildpack{
+				{URI: "fixtures/some-buildpack"},
+				{URI: "docker://paketobuildpacks/node-engine"},
+			},
+			Order: []dagger.BuilderOrderGroup{{
+				Group: []dagger.BuilderGroupEntry{
+					{ID: "some-buildpack", Version: "1.2.3"},
+					{ID: "paketo-buildpacks/node-engine", Optional: true},
+				},
+			}},
+			Stack: dagger.BuilderStack{
+				ID:         "io.buildpacks.stacks.bionic",
+				BuildImage: "paketobuildpacks/build:base-cnb",
+				RunImage:   "paketobuildpacks/run:base-cnb",
+			},
+			Lifecycle: &dagger.BuilderLifecycleSpec{Version: "0.9.1"},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(builder.Image).To(MatchRegexp(`^dagger-builder-[a-z0-9]{12}$`))
+
+		wd, err := os.Getwd()
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(builder.Logs).To(MatchRegexp(`\[\S+ create-builder dagger-builder-[a-z0-9]{12} --builder-config \S+/builder.toml\]`))
+		Expect(builder.Logs).To(ContainSubstring(`uri = "` + filepath.Join(wd, "fixtures/some-buildpack") + `"`))
+		Expect(builder.Logs).To(ContainSubstring(`uri = "docker://paketobuildpacks/node-engine"`))
+		Expect(builder.Logs).To(ContainSubstring(`optional = true`))
+		Expect(builder.Logs).To(ContainSubstring(`build-image = "paketobuildpacks/build:base-cnb"`))
+		Expect(builder.Logs).To(ContainSubstring("[lifecycle]\n  version = \"0.9.1\""))
+	})
+
+	it("leaves the lifecycle to pack when the spec does not pick one", func() {
+		builder, err := dagger.CreateBuilder(dagger.BuilderSpec{
+			Stack: dagger.BuilderStack{ID: "some-stack", BuildImage: "some-build-image", RunImage: "some-run-image"},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(builder.Logs).To(ContainSubstring(`run-image = "some-run-image"`))
+		Expect(builder.Logs).NotTo(ContainSubstring("lifecycle"))
+	})
+
+	when("pack supports the builder command", func() {
+		var existingPath string
+
+		it.Before(func() {
+			existingPath = useFakePack("0.15.0")
+		})
+
+		it.After(func() {
+			Expect(os.Setenv("PATH", existingPath)).To(Succeed())
+		})
+
+		it("creates the builder with pack builder create", func() {
+			builder, err := dagger.CreateBuilder(dagger.BuilderSpec{
+				Stack: dagger.BuilderStack{ID: "some-stack", BuildImage: "some-build-image", RunImage: "some-run-image"},
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(builder.Logs).To(MatchRegexp(`\[\S+ builder create dagger-builder-[a-z0-9]{12} --config \S+/builder.toml\]`))
+		})
+	})
+
+	it("does not change the spec it is given", func() {
+		buildpacks := []dagger.BuilderBuildpack{{URI: "fixtures/some-buildpack"}}
+		_, err := dagger.CreateBuilder(dagger.BuilderSpec{Buildpacks: buildpacks})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(buildpacks[0].URI).To(Equal("fixtures/some-buildpack"))
+	})
+
+	when("removing a builder", func() {
+		var (
+			server          *httptest.Server
+			removed         []string
+			existingHost    string
+			existingRuntime string
+		)
+
+		it.Before(func() {
+			removed = nil
+			server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				if req.Method == http.MethodDelete {
+					removed = append(removed, strings.TrimPrefix(req.URL.Path, "/images/"))
+				}
+				w.Write([]byte("[]"))
+			}))
+
+			existingHost = os.Getenv("DOCKER_HOST")
+			existingRuntime = os.Getenv(dagger.ContainerRuntimeEnv)
+			Expect(os.Setenv("DOCKER_HOST", strings.Replace(server.URL, "http://", "tcp://", 1))).To(Succeed())
+			Expect(os.Unsetenv(dagger.ContainerRuntimeEnv)).To(Succeed())
+		})
+
+		it.After(func() {
+			server.Close()
+			Expect(os.Setenv("DOCKER_HOST", existingHost)).To(Succeed())
+			Expect(os.Setenv(dagger.ContainerRuntimeEnv, existingRuntime)).To(Succeed())
+		})
+
+		it("removes its image", func() {
+			builder, err := dagger.CreateBuilder(dagger.BuilderSpec{})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(builder.Remove()).To(Succeed())
+			Expect(removed).To(Equal([]string{builder.Image}))
+		})
+	})
+}
@@ -0,0 +1,75 @@
+package dagger
+
+import (
+	"fmt"
+	"regexp"
+	"sync"
+)
+
+// builderReferencePattern loosely matches docker image references, such as
+// "paketobuildpacks/builder:base" or "localhost:5000/builder@sha256:...".
+var builderReferencePattern = regexp.MustCompile(`^[a-z0-9]+(?:[._-][a-z0-9]+)*(?::[0-9]+)?(?:/[a-z0-9]+(?:[._-]+[a-z0-9]+)*)*(?::[A-Za-z0-9_][A-Za-z0-9_.-]{0,127})?(?:@sha256:[a-f0-9]{64})?$`)
+
+var (
+	builderMutex   sync.RWMutex
+	defaultBuilder = Cflinuxfs3Builder
+)
+
+// RegisterBuilder makes alias usable in place of image with SetBuilder and
+// SetDefaultBuilder. Registering an existing alias replaces it.
+func RegisterBuilder(alias, image string) error {
+	if !builderReferencePattern.MatchString(image) {
+		return fmt.Errorf("invalid builder image reference %q", image)
+	}
+
+	builderMutex.Lock()
+	defer builderMutex.Unlock()
+
+	builderMap[alias] = image
+	return nil
+}
+
+// SetDefaultBuilder sets the builder, an image reference or alias, used by
+// packs that do not call SetBuilder.
+func SetDefaultBuilder(builder string) error {
+	image, err := getBuilderImage(builder)
+	if err != nil {
+		return err
+	}
+
+	builderMutex.Lock()
+	defer builderMutex.Unlock()
+
+	defaultBuilder = image
+	return nil
+}
+
+// DefaultBuilder returns the image of the default builder.
+func DefaultBuilder() string {
+	builderMutex.RLock()
+	defer builderMutex.RUnlock()
+
+	return defaultBuilder
+}
+
+// getBuilderImage resolves a builder alias to its image. Anything that is not
+// an alias is used as an image reference.
+func getBuilderImage(packBuilder string) (string, error) {
+	if packBuilder == "" {
+		return DefaultBuilder(), nil
+	}
+
+	builderMutex.RLock()
+	val, found := builderMap[packBuilder]
+	builderMutex.RUnlock()
+
+	if found {
+		return val, nil
+	}
+
+	if !builderReferencePattern.MatchString(packBuilder) {
+		return "", fmt.Errorf("invalid builder %q: please use a registered alias or an image reference", packBuilder)
+	}
+
+	return packBuilder, nil
+}
@@ -0,0 +1,249 @@
+package dagger
+
+import (
+	"path"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Lifecycle phases, as pack announces them with "===> PHASE".
+const (
+	PhaseDetecting = "DETECTING"
+	PhaseAnalyzing = "ANALYZING"
+	PhaseRestoring = "RESTORING"
+	PhaseBuilding  = "BUILDING"
+	PhaseExporting = "EXPORTING"
+)
+
+var (
+	phaseHeaderPattern     = regexp.MustCompile(`^===> ([A-Z]+)`)
+	phasePrefixPattern     = regexp.MustCompile(`^\[[a-z]+\] ?`)
+	timerPattern           = regexp.MustCompile(`^Timer: (\S+) ran for (\S+)`)
+	buildpackStartPattern  = regexp.MustCompile(`^Running build for buildpack (\S+)@(\S+)`)
+	buildpackEndPattern    = regexp.MustCompile(`^Finished running build for buildpack`)
+	participatingPattern   = regexp.MustCompile(`^\d+ of \d+ buildpacks participating`)
+	nonAlphanumericPattern = regexp.MustCompile(`[^a-z0-9]+`)
+
+	// timerPhases maps the lifecycle binaries named in timer lines to the
+	// phase they run
+	timerPhases = map[string]string{
+		"Detector": PhaseDetecting,
+		"Analyzer": PhaseAnalyzing,
+		"Restorer": PhaseRestoring,
+		"Builder":  PhaseBuilding,
+		"Exporter": PhaseExporting,
+	}
+)
+
+// BuildLog is the output of a pack build split by lifecycle phase.
+type BuildLog struct {
+	// Preamble is the output printed before the first phase, such as image
+	// pulls.
+	Preamble []string
+
+	Phases []BuildPhase
+
+	// Timings are the durations the lifecycle reports in verbose mode, keyed
+	// by the name it prints, such as "Builder".
+	Timings map[string]time.Duration
+}
+
+// BuildPhase is the output of one lifecycle phase, with the "[phase]" prefix
+// of each line removed.
+type BuildPhase struct {
+	Name     string
+	Lines    []string
+	Duration time.Duration
+
+	// Buildpacks holds the output of each buildpack during the BUILDING phase.
+	Buildpacks []BuildpackOutput
+}
+
+// BuildpackOutput is what a single buildpack printed while building.
+type BuildpackOutput struct {
+	ID      string
+	Version string
+	Lines   []string
+}
+
+// BuildLog parses the build logs of the app.
+func (a *App) BuildLog() BuildLog {
+	return ParseBuildLog(a.BuildLogs())
+}
+
+// ParseBuildLog parses pack build output. Buildpack sections are delimited by
+// the lifecycle's "Running build for buildpack" lines in verbose builds.
+// Otherwise every unindented line of the BUILDING phase is taken to be the
+// title a buildpack prints first, and is attributed to the next buildpack of
+// the detected group.
+func ParseBuildLog(logs string) BuildLog {
+	lines := strings.Split(strings.TrimRight(stripColor(logs), "\n"), "\n")
+
+	buildLog := BuildLog{Timings: map[string]time.Duration{}}
+	explicitSections := false
+	for _, line := range lines {
+		if buildpackStartPattern.MatchString(phasePrefixPattern.ReplaceAllString(line, "")) {
+			explicitSections = true
+			break
+		}
+	}
+
+	var (
+		phase     *BuildPhase
+		buildpack *BuildpackOutput
+		group     []BuildpackInfo
+	)
+
+	for _, line := range lines {
+		if match := phaseHeaderPattern.FindStringSubmatch(line); match != nil {
+			buildLog.Phases = append(buildLog.Phases, BuildPhase{Name: match[1]})
+			phase = &buildLog.Phases[len(buildLog.Phases)-1]
+			buildpack = nil
+
+			if phase.Name == PhaseBuilding {
+				group = detectedGroup(buildLog.Phase(PhaseDetecting))
+			}
+			continue
+		}
+
+		if phase == nil {
+			buildLog.Preamble = append(buildLog.Preamble, line)
+			continue
+		}
+
+		line = phasePrefixPattern.ReplaceAllString(line, "")
+		phase.Lines = append(phase.Lines, line)
+
+		if match := timerPattern.FindStringSubmatch(line); match != nil {
+			duration, err := time.ParseDuration(match[2])
+			if err == nil {
+				buildLog.Timings[match[1]] = duration
+			}
+			continue
+		}
+
+		if phase.Name != PhaseBuilding {
+			continue
+		}
+
+		switch {
+		case explicitSections:
+			if match := buildpackStartPattern.FindStringSubmatch(line); match != nil {
+				phase.Buildpacks = append(phase.Buildpacks, BuildpackOutput{ID: match[1], Version: match[2]})
+				buildpack = &phase.Buildpacks[len(phase.Buildpacks)-1]
+				continue
+			}
+
+			if buildpackEndPattern.MatchString(line) {
+				buildpack = nil
+				continue
+			}
+
+		case line != "" && !strings.HasPrefix(line, " ") && !strings.HasPrefix(line, "\t"):
+			rest, info, ok := matchInGroup(group, line)
+			if !ok {
+				// Unindented output of the current buildpack, such as a warning
+				break
+			}
+
+			group = rest
+			phase.Buildpacks = append(phase.Buildpacks, BuildpackOutput{ID: info.ID, Version: info.Version})
+			buildpack = &phase.Buildpacks[len(phase.Buildpacks)-1]
+		}
+
+		if buildpack != nil {
+			buildpack.Lines = append(buildpack.Lines, line)
+		}
+	}
+
+	for i := range buildLog.Phases {
+		for name, duration := range buildLog.Timings {
+			if timerPhases[name] == buildLog.Phases[i].Name {
+				buildLog.Phases[i].Duration = duration
+			}
+		}
+	}
+
+	return buildLog
+}
+
+// Phase returns the phase called name, or an empty phase if the build did
+// not reach it.
+func (l BuildLog) Phase(name string) BuildPhase {
+	for _, phase := range l.Phases {
+		if phase.Name == name {
+			return phase
+		}
+	}
+
+	return BuildPhase{Name: name}
+}
+
+// Buildpack returns the output of the buildpack with the given ID during the
+// BUILDING phase.
+func (l BuildLog) Buildpack(id string) (BuildpackOutput, bool) {
+	for _, buildpack := range l.Phase(PhaseBuilding).Buildpacks {
+		if buildpack.ID == id {
+			return buildpack, true
+		}
+	}
+
+	return BuildpackOutput{}, false
+}
+
+func (p BuildPhase) String() string {
+	return strings.Join(p.Lines, "\n")
+}
+
+func (b BuildpackOutput) String() string {
+	return strings.Join(b.Lines, "\n")
+}
+
+// detectedGroup parses the group the detector lists after its
+// "N of M buildpacks participating" line.
+func detectedGroup(phase BuildPhase) []BuildpackInfo {
+	var group []BuildpackInfo
+	participating := false
+	for _, line := range phase.Lines {
+		if participatingPattern.MatchString(line) {
+			participating = true
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if !participating || len(fields) != 2 {
+			continue
+		}
+
+		group = append(group, BuildpackInfo{ID: fields[0], Version: fields[1]})
+	}
+
+	return group
+}
+
+// matchInGroup finds the buildpack a section title belongs to: the first
+// remaining buildpack whose version or name appears in it. Buildpacks before
+// the match printed nothing and are dropped from group. Titles that match no
+// buildpack are not section titles.
+func matchInGroup(group []BuildpackInfo, title string) ([]BuildpackInfo, BuildpackInfo, bool) {
+	normalizedTitle := normalizeTitle(title)
+	for i, info := range group {
+		if info.Version != "" && strings.Contains(title, info.Version) {
+			return group[i+1:], info, true
+		}
+
+		name := normalizeTitle(path.Base(info.ID))
+		if name != "" && strings.Contains(normalizedTitle, name) {
+			return group[i+1:], info, true
+		}
+	}
+
+	return group, BuildpackInfo{}, false
+}
+
+// normalizeTitle lowercases s and drops everything but letters and digits,
+// so that "node-engine" matches "Node Engine".
+func normalizeTitle(s string) string {
+	return nonAlphanumericPattern.ReplaceAllString(strings.ToLower(s), "")
+}
@@ -0,0 +1,115 @@
+package dagger_test
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/cloudfoundry/dagger"
+	"github.com/sclevine/spec"
+
+	. "github.com/onsi/gomega"
+)
+
+func testBuildLog(t *testing.T, when spec.G, it spec.S) {
+	when("the lifecycle runs verbosely", func() {
+		it("splits the output by the lifecycle's buildpack markers", func() {
+			buildLog := dagger.ParseBuildLog(`Pulling image 'cloudfoundry/cnb:bionic'
+===> DETECTING
+[detector] 2 of 3 buildpacks participating
+[detector] paketo-buildpacks/node-engine 1.2.3
+[detector] paketo-buildpacks/npm-install 0.4.5
+[detector] Timer: Detector ran for 1.5s and ended at 2021-01-01T00:00:00Z
+===> BUILDING
+[builder] Running build for buildpack paketo-buildpacks/node-engine@1.2.3
+[builder] Node Engine 1.2.3
+[builder]   Installing node
+[builder] Finished running build for buildpack paketo-buildpacks/node-engine@1.2.3
+[builder] Running build for buildpack paketo-buildpacks/npm-install@0.4.5
+[builder] NPM Install 0.4.5
+[builder]   Installing node_modules
+[builder] Finished running build for buildpack paketo-buildpacks/npm-install@0.4.5
+[builder] Timer: Builder ran for 12.25s and ended at 2021-01-01T00:00:00Z
+===> EXPORTING
+[exporter] Adding layer 'paketo-buildpacks/node-engine:node'
+`)
+
+			Expect(buildLog.Preamble).To(Equal([]string{"Pulling image 'cloudfoundry/cnb:bionic'"}))
+			Expect(buildLog.Phases).To(HaveLen(3))
+			Expect(buildLog.Phase(dagger.PhaseExporting).String()).To(Equal("Adding layer 'paketo-buildpacks/node-engine:node'"))
+			Expect(buildLog.Phase(dagger.PhaseAnalyzing).Lines).To(BeEmpty())
+
+			npm, ok := buildLog.Buildpack("paketo-buildpacks/npm-install")
+			Expect(ok).To(BeTrue())
+			Expect(npm.Version).To(Equal("0.4.5"))
+			Expect(npm.Lines).To(Equal([]string{"NPM Install 0.4.5", "  Installing node_modules"}))
+
+			Expect(buildLog.Timings).To(Equal(map[string]time.Duration{
+				"Detector": 1500 * time.Millisecond,
+				"Builder":  12250 * time.Millisecond,
+			}))
+			Expect(buildLog.Phase(dagger.PhaseBuilding).Duration).To(Equal(12250 * time.Millisecond))
+		})
+	})
+
+	when("the lifecycle does not mark buildpacks", func() {
+		it("attributes each buildpack title to the detected group", func() {
+			app := dagger.NewApp("some-fixture", "some-image", "some-cache", bytes.NewBufferString(`===> DETECTING
+3 of 4 buildpacks participating
+paketo-buildpacks/ca-certificates 2.0.0
+paketo-buildpacks/node-engine 1.2.3
+paketo-buildpacks/npm-install 0.4.5
+===> BUILDING
+
+Paketo Node Engine Buildpack 1.2.3
+  Installing node
+
+Paketo NPM Install Buildpack 0.4.5
+  Installing node_modules
+`), nil)
+
+			buildLog := app.BuildLog()
+			building := buildLog.Phase(dagger.PhaseBuilding)
+			Expect(building.Buildpacks).To(HaveLen(2))
+
+			node, ok := buildLog.Buildpack("paketo-buildpacks/node-engine")
+			Expect(ok).To(BeTrue())
+			Expect(node.String()).To(Equal("Paketo Node Engine Buildpack 1.2.3\n  Installing node\n"))
+
+			_, ok = buildLog.Buildpack("paketo-buildpacks/ca-certificates")
+			Expect(ok).To(BeFalse())
+		})
+
+		it("keeps unindented lines that name no buildpack with the current buildpack", func() {
+			buildLog := dagger.ParseBuildLog(`===> DETECTING
+2 of 2 buildpacks participating
+paketo-buildpacks/node-engine 1.2.3
+paketo-buildpacks/npm-install 0.4.5
+===> BUILDING
+Paketo Node Engine Buildpack 1.2.3
+  Installing node
+WARNING: this version of node is deprecated
+Upgrade to a newer one soon
+Paketo NPM Install Buildpack
+  Installing node_modules
+Done
+`)
+
+			building := buildLog.Phase(dagger.PhaseBuilding)
+			Expect(building.Buildpacks).To(HaveLen(2))
+
+			node, ok := buildLog.Buildpack("paketo-buildpacks/node-engine")
+			Expect(ok).To(BeTrue())
+			Expect(node.Lines).To(Equal([]string{
+				"Paketo Node Engine Buildpack 1.2.3",
+				"  Installing node",
+				"WARNING: this version of node is deprecated",
+				"Upgrade to a newer one soon",
+			}))
+
+			npm, ok := buildLog.Buildpack("paketo-buildpacks/npm-install")
+			Expect(ok).To(BeTrue())
+			Expect(npm.Lines).To(Equal([]string{"Paketo NPM Install Buildpack", "  Installing node_modules", "Done"}))
+		})
+	})
+}
@@ -8,6 +8,7 @@ import (
 
 type TestConfig struct {
 	Builder        string              `json:"builder"`
+	Builders       map[string]string   `json:"builders"`
 	BuildpackOrder map[string][]string `json:"buildpackOrder"`
 }
 
@@ -24,3 +25,20 @@ func ParseConfig(configPath string) (TestConfig, error) {
 
 	return config, nil
 }
+
+// ConfigureBuilders registers the builder aliases of the config and makes its
+// builder, when set, the default one.
+func (c TestConfig) ConfigureBuilders() error {
+	for alias, image := range c.Builders {
+		err := RegisterBuilder(alias, image)
+		if err != nil {
+			return err
+		}
+	}
+
+	if c.Builder != "" {
+		return SetDefaultBuilder(c.Builder)
+	}
+
+	return nil
+}
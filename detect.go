@@ -0,0 +1,96 @@
+package dagger
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+)
+
+var (
+	detectResultsPattern = regexp.MustCompile(`^=+ Results =+$`)
+	detectStatusPattern  = regexp.MustCompile(`^(pass|fail|skip|err): (\S+)@(\S+)$`)
+)
+
+// DetectResult describes how the lifecycle picked the buildpacks for an app.
+type DetectResult struct {
+	// Group is the buildpack group selected to build the app.
+	Group []BuildpackInfo
+
+	// Passed and Failed are the buildpacks whose detection passed or failed
+	// in any group that was tried. They are only known from verbose builds;
+	// otherwise Passed is the selected group.
+	Passed []BuildpackInfo
+	Failed []BuildpackInfo
+
+	// SkippedGroups are the groups tried before the selected one, which did
+	// not pass detection. They are only known from verbose builds.
+	SkippedGroups [][]BuildpackInfo
+}
+
+// DetectResult returns the detection result of the build. The selected group
+// is read from the image labels when the image can be inspected, and from the
+// detect output otherwise.
+func (a *App) DetectResult() (DetectResult, error) {
+	detecting := a.BuildLog().Phase(PhaseDetecting)
+
+	var result DetectResult
+	metadata, err := a.Metadata()
+	if err == nil && len(metadata.Build.Buildpacks) > 0 {
+		for _, buildpack := range metadata.Build.Buildpacks {
+			result.Group = append(result.Group, BuildpackInfo{ID: buildpack.ID, Version: buildpack.Version})
+		}
+	} else {
+		result.Group = detectedGroup(detecting)
+	}
+
+	if len(result.Group) == 0 && len(detecting.Lines) == 0 {
+		if err == nil {
+			err = errors.New("no buildpacks recorded")
+		}
+		return DetectResult{}, fmt.Errorf("failed to find detection result of image %s: %w", a.ImageName, err)
+	}
+
+	var groups [][]BuildpackInfo
+	passed := map[BuildpackInfo]bool{}
+	failed := map[BuildpackInfo]bool{}
+	for _, line := range detecting.Lines {
+		if detectResultsPattern.MatchString(line) {
+			groups = append(groups, nil)
+			continue
+		}
+
+		match := detectStatusPattern.FindStringSubmatch(line)
+		if match == nil || len(groups) == 0 {
+			continue
+		}
+
+		info := BuildpackInfo{ID: match[2], Version: match[3]}
+		groups[len(groups)-1] = append(groups[len(groups)-1], info)
+
+		switch match[1] {
+		case "pass":
+			if !passed[info] {
+				passed[info] = true
+				result.Passed = append(result.Passed, info)
+			}
+		case "fail", "err":
+			if !failed[info] {
+				failed[info] = true
+				result.Failed = append(result.Failed, info)
+			}
+		}
+	}
+
+	if len(groups) == 0 {
+		result.Passed = result.Group
+		return result, nil
+	}
+
+	// The detector stops at the first group that passes
+	if len(result.Group) > 0 {
+		groups = groups[:len(groups)-1]
+	}
+	result.SkippedGroups = groups
+
+	return result, nil
+}
@@ -0,0 +1,70 @@
+package dagger_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/cloudfoundry/dagger"
+	fakes "github.com/cloudfoundry/dagger/fakes/runtime"
+	"github.com/sclevine/spec"
+
+	. "github.com/onsi/gomega"
+)
+
+func testDetect(t *testing.T, when spec.G, it spec.S) {
+	var (
+		app     dagger.App
+		runtime *fakes.ContainerRuntime
+	)
+
+	it.Before(func() {
+		runtime = &fakes.ContainerRuntime{}
+		app = dagger.NewApp("some-fixture", "some-image", "some-cache", bytes.NewBufferString(`===> DETECTING
+[detector] ======== Results ========
+[detector] pass: paketo-buildpacks/node-engine@1.2.3
+[detector] fail: paketo-buildpacks/yarn-install@0.1.0
+[detector] ======== Results ========
+[detector] pass: paketo-buildpacks/node-engine@1.2.3
+[detector] pass: paketo-buildpacks/npm-install@0.4.5
+[detector] skip: paketo-buildpacks/procfile@1.0.0
+[detector] 2 of 3 buildpacks participating
+[detector] paketo-buildpacks/node-engine 1.2.3
+[detector] paketo-buildpacks/npm-install 0.4.5
+===> BUILDING
+`), nil)
+		app.SetContainerRuntime(runtime)
+	})
+
+	it("reads the group from the image labels", func() {
+		runtime.Image.Config.Labels = map[string]string{
+			dagger.LifecycleMetadataLabel: `{}`,
+			dagger.BuildMetadataLabel:     `{"buildpacks": [{"id": "paketo-buildpacks/node-engine", "version": "1.2.3", "homepage": "some-homepage"}]}`,
+		}
+
+		result, err := app.DetectResult()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.Group).To(Equal([]dagger.BuildpackInfo{{ID: "paketo-buildpacks/node-engine", Version: "1.2.3"}}))
+	})
+
+	it("falls back to the detect output and reports every group tried", func() {
+		result, err := app.DetectResult()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result).To(Equal(dagger.DetectResult{
+			Group: []dagger.BuildpackInfo{
+				{ID: "paketo-buildpacks/node-engine", Version: "1.2.3"},
+				{ID: "paketo-buildpacks/npm-install", Version: "0.4.5"},
+			},
+			Passed: []dagger.BuildpackInfo{
+				{ID: "paketo-buildpacks/node-engine", Version: "1.2.3"},
+				{ID: "paketo-buildpacks/npm-install", Version: "0.4.5"},
+			},
+			Failed: []dagger.BuildpackInfo{
+				{ID: "paketo-buildpacks/yarn-install", Version: "0.1.0"},
+			},
+			SkippedGroups: [][]dagger.BuildpackInfo{{
+				{ID: "paketo-buildpacks/node-engine", Version: "1.2.3"},
+				{ID: "paketo-buildpacks/yarn-install", Version: "0.1.0"},
+			}},
+		}))
+	})
+}
@@ -0,0 +1,648 @@
+package dagger
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const DefaultDockerHost = "unix:///var/run/docker.sock"
+
+// DockerClient talks to the Docker Engine API directly rather than going
+// through the docker CLI.
+type DockerClient struct {
+	client  *http.Client
+	baseURL string
+}
+
+// DockerAPIError is returned when the Docker Engine API responds with a
+// non-successful status code.
+type DockerAPIError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *DockerAPIError) Error() string {
+	return fmt.Sprintf("docker engine API error (status %d): %s", e.StatusCode, e.Message)
+}
+
+// IsNotFound reports whether err is a Docker Engine API "no such object" error.
+func IsNotFound(err error) bool {
+	var apiErr *DockerAPIError
+	return errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound
+}
+
+type ContainerConfig struct {
+	Image        string              `json:"Image"`
+	Cmd          []string            `json:"Cmd,omitempty"`
+	Env          []string            `json:"Env,omitempty"`
+	User         string              `json:"User,omitempty"`
+	ExposedPorts map[string]struct{} `json:"ExposedPorts,omitempty"`
+	Labels       map[string]string   `json:"Labels,omitempty"`
+	Healthcheck  *HealthConfig       `json:"Healthcheck,omitempty"`
+	HostConfig   HostConfig          `json:"HostConfig"`
+
+	NetworkingConfig *NetworkingConfig `json:"NetworkingConfig,omitempty"`
+}
+
+type NetworkingConfig struct {
+	EndpointsConfig map[string]EndpointSettings `json:"EndpointsConfig"`
+}
+
+type EndpointSettings struct {
+	Aliases []string `json:"Aliases,omitempty"`
+}
+
+type HealthConfig struct {
+	Test     []string      `json:"Test,omitempty"`
+	Interval time.Duration `json:"Interval,omitempty"`
+	Timeout  time.Duration `json:"Timeout,omitempty"`
+	Retries  int           `json:"Retries,omitempty"`
+}
+
+type HostConfig struct {
+	Memory          int64                    `json:"Memory,omitempty"`
+	NanoCPUs        int64                    `json:"NanoCpus,omitempty"`
+	PidsLimit       int64                    `json:"PidsLimit,omitempty"`
+	ReadonlyRootfs  bool                     `json:"ReadonlyRootfs,omitempty"`
+	Tmpfs           map[string]string        `json:"Tmpfs,omitempty"`
+	CapAdd          []string                 `json:"CapAdd,omitempty"`
+	CapDrop         []string                 `json:"CapDrop,omitempty"`
+	Ulimits         []Ulimit                 `json:"Ulimits,omitempty"`
+	PortBindings    map[string][]PortBinding `json:"PortBindings,omitempty"`
+	PublishAllPorts bool                     `json:"PublishAllPorts,omitempty"`
+	NetworkMode     string                   `json:"NetworkMode,omitempty"`
+	Mounts          []Mount                  `json:"Mounts,omitempty"`
+}
+
+type PortBinding struct {
+	HostIP   string `json:"HostIp"`
+	HostPort string `json:"HostPort"`
+}
+
+type ContainerJSON struct {
+	ID              string          `json:"Id"`
+	Name            string          `json:"Name"`
+	Image           string          `json:"Image"`
+	State           ContainerState  `json:"State"`
+	Config          ContainerConfig `json:"Config"`
+	NetworkSettings NetworkSettings `json:"NetworkSettings"`
+}
+
+type ContainerState struct {
+	Status   string  `json:"Status"`
+	Running  bool    `json:"Running"`
+	ExitCode int     `json:"ExitCode"`
+	Health   *Health `json:"Health"`
+}
+
+type NetworkSettings struct {
+	Ports map[string][]PortBinding `json:"Ports"`
+}
+
+type ImageJSON struct {
+	ID       string   `json:"Id"`
+	RepoTags []string `json:"RepoTags"`
+	Size     int64    `json:"Size"`
+	Config   struct {
+		Labels map[string]string `json:"Labels"`
+	} `json:"Config"`
+	RootFS struct {
+		Type   string   `json:"Type"`
+		Layers []string `json:"Layers"`
+	} `json:"RootFS"`
+}
+
+// ContainerSummary is an entry of the container list.
+type ContainerSummary struct {
+	ID      string       `json:"Id"`
+	Image   string       `json:"Image"`
+	Command string       `json:"Command"`
+	Created int64        `json:"Created"`
+	Mounts  []MountPoint `json:"Mounts"`
+}
+
+// MountPoint is a mount of a listed container. Name is only set for volumes.
+type MountPoint struct {
+	Name        string `json:"Name"`
+	Source      string `json:"Source"`
+	Destination string `json:"Destination"`
+}
+
+type ExecConfig struct {
+	Cmd          []string `json:"Cmd"`
+	Env          []string `json:"Env,omitempty"`
+	User         string   `json:"User,omitempty"`
+	WorkingDir   string   `json:"WorkingDir,omitempty"`
+	AttachStdout bool     `json:"AttachStdout"`
+	AttachStderr bool     `json:"AttachStderr"`
+}
+
+type ExecInspect struct {
+	ID       string `json:"ID"`
+	Running  bool   `json:"Running"`
+	ExitCode int    `json:"ExitCode"`
+}
+
+type Volume struct {
+	Name   string            `json:"Name"`
+	Driver string            `json:"Driver"`
+	Labels map[string]string `json:"Labels"`
+}
+
+// NewDockerClient returns a client for the daemon at host. An empty host
+// falls back to $DOCKER_HOST and then to DefaultDockerHost. Both unix:// and
+// tcp:// hosts are supported.
+func NewDockerClient(host string) (*DockerClient, error) {
+	if host == "" {
+		host = os.Getenv("DOCKER_HOST")
+	}
+
+	if host == "" {
+		host = DefaultDockerHost
+	}
+
+	hostURL, err := url.Parse(host)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse docker host %q: %w", host, err)
+	}
+
+	transport := &http.Transport{}
+	baseURL := ""
+	switch hostURL.Scheme {
+	case "unix":
+		socket := hostURL.Path
+		transport.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var dialer net.Dialer
+			return dialer.DialContext(ctx, "unix", socket)
+		}
+		baseURL = "http://docker"
+	case "tcp", "http":
+		baseURL = fmt.Sprintf("http://%s", hostURL.Host)
+	default:
+		return nil, fmt.Errorf("unsupported docker host scheme %q in %q", hostURL.Scheme, host)
+	}
+
+	return &DockerClient{
+		client:  &http.Client{Transport: transport},
+		baseURL: baseURL,
+	}, nil
+}
+
+func (d *DockerClient) ContainerCreate(ctx context.Context, config ContainerConfig) (string, error) {
+	var created struct {
+		ID string `json:"Id"`
+	}
+
+	err := d.do(ctx, http.MethodPost, "/containers/create", nil, config, &created)
+	if err != nil {
+		return "", fmt.Errorf("failed to create container from %s: %w", config.Image, err)
+	}
+
+	return created.ID, nil
+}
+
+func (d *DockerClient) ContainerStart(ctx context.Context, id string) error {
+	err := d.do(ctx, http.MethodPost, fmt.Sprintf("/containers/%s/start", id), nil, nil, nil)
+	if err != nil {
+		return fmt.Errorf("failed to start container %s: %w", id, err)
+	}
+
+	return nil
+}
+
+// ContainerList lists containers, including stopped ones, that match the
+// filters, such as {"ancestor": ["some-image"]}.
+func (d *DockerClient) ContainerList(ctx context.Context, filters map[string][]string) ([]ContainerSummary, error) {
+	query := url.Values{"all": {"1"}}
+	if len(filters) > 0 {
+		content, err := json.Marshal(filters)
+		if err != nil {
+			return nil, err
+		}
+		query.Set("filters", string(content))
+	}
+
+	var containers []ContainerSummary
+	err := d.do(ctx, http.MethodGet, "/containers/json", query, nil, &containers)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list containers: %w", err)
+	}
+
+	return containers, nil
+}
+
+func (d *DockerClient) ContainerInspect(ctx context.Context, id string) (ContainerJSON, error) {
+	var container ContainerJSON
+	err := d.do(ctx, http.MethodGet, fmt.Sprintf("/containers/%s/json", id), nil, nil, &container)
+	if err != nil {
+		return ContainerJSON{}, fmt.Errorf("failed to inspect container %s: %w", id, err)
+	}
+
+	return container, nil
+}
+
+// ContainerLogs returns the combined stdout and stderr of a container. When
+// follow is true the reader stays open until the container stops or the
+// context is cancelled.
+func (d *DockerClient) ContainerLogs(ctx context.Context, id string, follow bool) (io.ReadCloser, error) {
+	query := url.Values{"stdout": {"1"}, "stderr": {"1"}}
+	if follow {
+		query.Set("follow", "1")
+	}
+
+	resp, err := d.stream(ctx, http.MethodGet, fmt.Sprintf("/containers/%s/logs", id), query, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get logs of container %s: %w", id, err)
+	}
+
+	reader, writer := io.Pipe()
+	go func() {
+		defer resp.Body.Close()
+		writer.CloseWithError(demultiplex(writer, writer, resp.Body))
+	}()
+
+	return reader, nil
+}
+
+// ContainerWait blocks until the container stops and returns its exit code.
+func (d *DockerClient) ContainerWait(ctx context.Context, id string) (int, error) {
+	var result struct {
+		StatusCode int `json:"StatusCode"`
+	}
+
+	err := d.do(ctx, http.MethodPost, fmt.Sprintf("/containers/%s/wait", id), nil, nil, &result)
+	if err != nil {
+		return 0, fmt.Errorf("failed to wait for container %s: %w", id, err)
+	}
+
+	return result.StatusCode, nil
+}
+
+func (d *DockerClient) ContainerStop(ctx context.Context, id string) error {
+	err := d.do(ctx, http.MethodPost, fmt.Sprintf("/containers/%s/stop", id), nil, nil, nil)
+	if err != nil {
+		return fmt.Errorf("failed to stop container %s: %w", id, err)
+	}
+
+	return nil
+}
+
+// ContainerRemove force removes a container along with its anonymous volumes.
+func (d *DockerClient) ContainerRemove(ctx context.Context, id string) error {
+	query := url.Values{"force": {"1"}, "v": {"1"}}
+	err := d.do(ctx, http.MethodDelete, fmt.Sprintf("/containers/%s", id), query, nil, nil)
+	if err != nil {
+		return fmt.Errorf("failed to remove container %s: %w", id, err)
+	}
+
+	return nil
+}
+
+// ContainerArchive returns a tar archive of path in a container, which does
+// not need to be running.
+func (d *DockerClient) ContainerArchive(ctx context.Context, id, path string) (io.ReadCloser, error) {
+	resp, err := d.stream(ctx, http.MethodGet, fmt.Sprintf("/containers/%s/archive", id), url.Values{"path": {path}}, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to copy %s from container %s: %w", path, id, err)
+	}
+
+	return resp.Body, nil
+}
+
+func (d *DockerClient) ExecCreate(ctx context.Context, id string, config ExecConfig) (string, error) {
+	var created struct {
+		ID string `json:"Id"`
+	}
+
+	err := d.do(ctx, http.MethodPost, fmt.Sprintf("/containers/%s/exec", id), nil, config, &created)
+	if err != nil {
+		return "", fmt.Errorf("failed to create exec in container %s: %w", id, err)
+	}
+
+	return created.ID, nil
+}
+
+// ExecStart runs an exec instance and copies its output until it finishes.
+func (d *DockerClient) ExecStart(ctx context.Context, execID string, stdout, stderr io.Writer) error {
+	body := map[string]bool{"Detach": false, "Tty": false}
+	resp, err := d.stream(ctx, http.MethodPost, fmt.Sprintf("/exec/%s/start", execID), nil, body)
+	if err != nil {
+		return fmt.Errorf("failed to start exec %s: %w", execID, err)
+	}
+	defer resp.Body.Close()
+
+	return demultiplex(stdout, stderr, resp.Body)
+}
+
+func (d *DockerClient) ExecInspect(ctx context.Context, execID string) (ExecInspect, error) {
+	var inspect ExecInspect
+	err := d.do(ctx, http.MethodGet, fmt.Sprintf("/exec/%s/json", execID), nil, nil, &inspect)
+	if err != nil {
+		return ExecInspect{}, fmt.Errorf("failed to inspect exec %s: %w", execID, err)
+	}
+
+	return inspect, nil
+}
+
+func (d *DockerClient) ImageInspect(ctx context.Context, name string) (ImageJSON, error) {
+	var image ImageJSON
+	err := d.do(ctx, http.MethodGet, fmt.Sprintf("/images/%s/json", name), nil, nil, &image)
+	if err != nil {
+		return ImageJSON{}, fmt.Errorf("failed to inspect image %s: %w", name, err)
+	}
+
+	return image, nil
+}
+
+// ImagePull pulls an image reference, such as "registry:2". Pull failures
+// are reported in the progress stream rather than by status code.
+func (d *DockerClient) ImagePull(ctx context.Context, name string) error {
+	resp, err := d.stream(ctx, http.MethodPost, "/images/create", url.Values{"fromImage": {name}}, nil)
+	if err != nil {
+		return fmt.Errorf("failed to pull image %s: %w", name, err)
+	}
+	defer resp.Body.Close()
+
+	decoder := json.NewDecoder(resp.Body)
+	for {
+		var progress struct {
+			Error string `json:"error"`
+		}
+
+		err = decoder.Decode(&progress)
+		if err == io.EOF {
+			return nil
+		}
+
+		if err != nil {
+			return fmt.Errorf("failed to pull image %s: %w", name, err)
+		}
+
+		if progress.Error != "" {
+			return fmt.Errorf("failed to pull image %s: %s", name, progress.Error)
+		}
+	}
+}
+
+// ImageSave returns the image as a `docker save` tarball.
+func (d *DockerClient) ImageSave(ctx context.Context, name string) (io.ReadCloser, error) {
+	resp, err := d.stream(ctx, http.MethodGet, fmt.Sprintf("/images/%s/get", name), nil, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to save image %s: %w", name, err)
+	}
+
+	return resp.Body, nil
+}
+
+func (d *DockerClient) ImageRemove(ctx context.Context, name string) error {
+	query := url.Values{"force": {"1"}}
+	err := d.do(ctx, http.MethodDelete, fmt.Sprintf("/images/%s", name), query, nil, nil)
+	if err != nil {
+		return fmt.Errorf("failed to remove image %s: %w", name, err)
+	}
+
+	return nil
+}
+
+// ImagesPrune removes dangling images, like `docker image prune -f`.
+func (d *DockerClient) ImagesPrune(ctx context.Context) error {
+	err := d.do(ctx, http.MethodPost, "/images/prune", nil, nil, nil)
+	if err != nil {
+		return fmt.Errorf("failed to prune images: %w", err)
+	}
+
+	return nil
+}
+
+func (d *DockerClient) VolumeInspect(ctx context.Context, name string) (Volume, error) {
+	var volume Volume
+	err := d.do(ctx, http.MethodGet, fmt.Sprintf("/volumes/%s", name), nil, nil, &volume)
+	if err != nil {
+		return Volume{}, fmt.Errorf("failed to inspect volume %s: %w", name, err)
+	}
+
+	return volume, nil
+}
+
+func (d *DockerClient) VolumeList(ctx context.Context) ([]Volume, error) {
+	var list struct {
+		Volumes []Volume `json:"Volumes"`
+	}
+
+	err := d.do(ctx, http.MethodGet, "/volumes", nil, nil, &list)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list volumes: %w", err)
+	}
+
+	return list.Volumes, nil
+}
+
+func (d *DockerClient) VolumeRemove(ctx context.Context, name string) error {
+	err := d.do(ctx, http.MethodDelete, fmt.Sprintf("/volumes/%s", name), nil, nil, nil)
+	if err != nil {
+		return fmt.Errorf("failed to remove volume %s: %w", name, err)
+	}
+
+	return nil
+}
+
+func (d *DockerClient) NetworkCreate(ctx context.Context, name string) (string, error) {
+	var created struct {
+		ID string `json:"Id"`
+	}
+
+	err := d.do(ctx, http.MethodPost, "/networks/create", nil, map[string]interface{}{
+		"Name":           name,
+		"CheckDuplicate": true,
+	}, &created)
+	if err != nil {
+		return "", fmt.Errorf("failed to create network %s: %w", name, err)
+	}
+
+	return created.ID, nil
+}
+
+func (d *DockerClient) NetworkRemove(ctx context.Context, name string) error {
+	err := d.do(ctx, http.MethodDelete, fmt.Sprintf("/networks/%s", name), nil, nil, nil)
+	if err != nil {
+		return fmt.Errorf("failed to remove network %s: %w", name, err)
+	}
+
+	return nil
+}
+
+// Exists reports whether a container, image or volume called name exists,
+// mirroring what `docker inspect` would find.
+func (d *DockerClient) Exists(ctx context.Context, name string) (bool, error) {
+	if name == "" {
+		return false, nil
+	}
+
+	lookups := []func(context.Context, string) error{
+		func(ctx context.Context, name string) error {
+			_, err := d.ContainerInspect(ctx, name)
+			return err
+		},
+		func(ctx context.Context, name string) error {
+			_, err := d.ImageInspect(ctx, name)
+			return err
+		},
+		func(ctx context.Context, name string) error {
+			_, err := d.VolumeInspect(ctx, name)
+			return err
+		},
+	}
+
+	for _, lookup := range lookups {
+		err := lookup(ctx, name)
+		if err == nil {
+			return true, nil
+		}
+
+		if !IsNotFound(err) {
+			return false, err
+		}
+	}
+
+	return false, nil
+}
+
+func (d *DockerClient) do(ctx context.Context, method, path string, query url.Values, body, result interface{}) error {
+	resp, err := d.stream(ctx, method, path, query, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if result == nil {
+		_, err = io.Copy(ioutil.Discard, resp.Body)
+		return err
+	}
+
+	return json.NewDecoder(resp.Body).Decode(result)
+}
+
+func (d *DockerClient) stream(ctx context.Context, method, path string, query url.Values, body interface{}) (*http.Response, error) {
+	var payload io.Reader
+	if body != nil {
+		content, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		payload = bytes.NewReader(content)
+	}
+
+	uri := d.baseURL + path
+	if len(query) > 0 {
+		uri = fmt.Sprintf("%s?%s", uri, query.Encode())
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, uri, payload)
+	if err != nil {
+		return nil, err
+	}
+
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	// 304 is returned when stopping an already stopped container
+	if resp.StatusCode >= 300 && resp.StatusCode != http.StatusNotModified {
+		defer resp.Body.Close()
+
+		content, _ := ioutil.ReadAll(resp.Body)
+		message := struct {
+			Message string `json:"message"`
+		}{}
+		if json.Unmarshal(content, &message) != nil || message.Message == "" {
+			message.Message = strings.TrimSpace(string(content))
+		}
+
+		return nil, &DockerAPIError{StatusCode: resp.StatusCode, Message: message.Message}
+	}
+
+	return resp, nil
+}
+
+// demultiplex splits the stdout and stderr frames of a non-TTY container
+// stream. Each frame starts with an 8 byte header holding the stream type in
+// the first byte and the big-endian frame size in the last four.
+func demultiplex(stdout, stderr io.Writer, src io.Reader) error {
+	header := make([]byte, 8)
+	for {
+		_, err := io.ReadFull(src, header)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		dst := stdout
+		if header[0] == 2 {
+			dst = stderr
+		}
+
+		size := int64(binary.BigEndian.Uint32(header[4:]))
+		_, err = io.CopyN(dst, src, size)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// memoryPattern is the syntax the docker CLI accepts for memory values: a
+// number, an optional space and a binary unit such as "k", "mib" or "GB".
+var memoryPattern = regexp.MustCompile(`^(\d+(?:\.\d+)*) ?([kKmMgGtTpP])?[iI]?[bB]?$`)
+
+// parseMemory converts a docker memory string such as "512m", "1gib" or
+// "512 M" into bytes, the same way the docker CLI does.
+func parseMemory(memory string) (int64, error) {
+	units := map[string]float64{
+		"":  1,
+		"k": 1 << 10,
+		"m": 1 << 20,
+		"g": 1 << 30,
+		"t": 1 << 40,
+		"p": 1 << 50,
+	}
+
+	matches := memoryPattern.FindStringSubmatch(memory)
+	if matches == nil {
+		return 0, fmt.Errorf("invalid memory value %q", memory)
+	}
+
+	amount, err := strconv.ParseFloat(matches[1], 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid memory value %q", memory)
+	}
+
+	return int64(amount * units[strings.ToLower(matches[2])]), nil
+}
+
+func shortID(id string) string {
+	if len(id) > 12 {
+		return id[:12]
+	}
+
+	return id
+}
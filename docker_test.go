@@ -0,0 +1,368 @@
+package dagger_test
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/cloudfoundry/dagger"
+	"github.com/sclevine/spec"
+
+	. "github.com/onsi/gomega"
+)
+
+func testDockerClient(t *testing.T, when spec.G, it spec.S) {
+	var (
+		tmpDir   string
+		server   *http.Server
+		mux      *http.ServeMux
+		client   *dagger.DockerClient
+		requests []*http.Request
+	)
+
+	it.Before(func() {
+		var err error
+		tmpDir, err = ioutil.TempDir("", "docker")
+		Expect(err).NotTo(HaveOccurred())
+
+		socket := filepath.Join(tmpDir, "docker.sock")
+		listener, err := net.Listen("unix", socket)
+		Expect(err).NotTo(HaveOccurred())
+
+		requests = nil
+		mux = http.NewServeMux()
+		server = &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			requests = append(requests, req)
+			mux.ServeHTTP(w, req)
+		})}
+		go server.Serve(listener)
+
+		client, err = dagger.NewDockerClient("unix://" + socket)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	it.After(func() {
+		Expect(server.Close()).To(Succeed())
+		Expect(os.RemoveAll(tmpDir)).To(Succeed())
+	})
+
+	when("inspecting a container", func() {
+		it("returns the typed container state", func() {
+			mux.HandleFunc("/containers/some-id/json", func(w http.ResponseWriter, req *http.Request) {
+				w.Write([]byte(`{
+					"Id": "some-id",
+					"State": {"Status": "running", "Running": true, "Health": {"Status": "healthy", "Log": [{"ExitCode": 0, "Output": "ok"}]}},
+					"NetworkSettings": {"Ports": {"8080/tcp": [{"HostIp": "0.0.0.0", "HostPort": "32768"}]}}
+				}`))
+			})
+
+			container, err := client.ContainerInspect(context.Background(), "some-id")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(container.State.Running).To(BeTrue())
+			Expect(container.State.Health.Status).To(Equal("healthy"))
+			Expect(container.State.Health.Log[0].Output).To(Equal("ok"))
+			Expect(container.NetworkSettings.Ports["8080/tcp"]).To(ConsistOf(dagger.PortBinding{HostIP: "0.0.0.0", HostPort: "32768"}))
+		})
+
+		it("reports missing containers as not found", func() {
+			mux.HandleFunc("/containers/missing/json", func(w http.ResponseWriter, req *http.Request) {
+				w.WriteHeader(http.StatusNotFound)
+				w.Write([]byte(`{"message": "No such container: missing"}`))
+			})
+
+			_, err := client.ContainerInspect(context.Background(), "missing")
+			Expect(err).To(MatchError(ContainSubstring("No such container: missing")))
+			Expect(dagger.IsNotFound(err)).To(BeTrue())
+		})
+	})
+
+	when("creating a container", func() {
+		it("sends the container config and returns the id", func() {
+			var config dagger.ContainerConfig
+			mux.HandleFunc("/containers/create", func(w http.ResponseWriter, req *http.Request) {
+				Expect(req.Method).To(Equal(http.MethodPost))
+				Expect(json.NewDecoder(req.Body).Decode(&config)).To(Succeed())
+				w.WriteHeader(http.StatusCreated)
+				w.Write([]byte(`{"Id": "0123456789abcdef"}`))
+			})
+
+			id, err := client.ContainerCreate(context.Background(), dagger.ContainerConfig{
+				Image: "some-image",
+				Cmd:   []string{"some-command"},
+				HostConfig: dagger.HostConfig{
+					PortBindings: map[string][]dagger.PortBinding{"8080/tcp": {{}}},
+				},
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(id).To(Equal("0123456789abcdef"))
+			Expect(config.Image).To(Equal("some-image"))
+			Expect(config.Cmd).To(Equal([]string{"some-command"}))
+			Expect(config.HostConfig.PortBindings).To(HaveKey("8080/tcp"))
+		})
+	})
+
+	when("running a container", func() {
+		it("removes the container when it fails to start", func() {
+			mux.HandleFunc("/containers/create", func(w http.ResponseWriter, req *http.Request) {
+				w.WriteHeader(http.StatusCreated)
+				w.Write([]byte(`{"Id": "some-id"}`))
+			})
+			mux.HandleFunc("/containers/some-id/start", func(w http.ResponseWriter, req *http.Request) {
+				w.WriteHeader(http.StatusInternalServerError)
+				w.Write([]byte(`{"message": "port is already allocated"}`))
+			})
+
+			var removed bool
+			mux.HandleFunc("/containers/some-id", func(w http.ResponseWriter, req *http.Request) {
+				Expect(req.Method).To(Equal(http.MethodDelete))
+				Expect(req.URL.Query().Get("force")).To(Equal("1"))
+				removed = true
+				w.WriteHeader(http.StatusNoContent)
+			})
+
+			_, err := dagger.NewDockerRuntime(client).Run(context.Background(), dagger.RunConfig{Image: "some-image"})
+			Expect(err).To(MatchError(ContainSubstring("port is already allocated")))
+			Expect(removed).To(BeTrue())
+		})
+	})
+
+	when("creating a container with run options", func() {
+		it("sends the resource limits and security settings", func() {
+			var config dagger.ContainerConfig
+			mux.HandleFunc("/containers/create", func(w http.ResponseWriter, req *http.Request) {
+				Expect(json.NewDecoder(req.Body).Decode(&config)).To(Succeed())
+				w.WriteHeader(http.StatusCreated)
+				w.Write([]byte(`{"Id": "some-id"}`))
+			})
+
+			_, err := dagger.NewDockerRuntime(client).Create(context.Background(), dagger.RunConfig{
+				Image: "some-image",
+				Options: dagger.RunOptions{
+					CPUs:      1.5,
+					PidsLimit: 100,
+					ReadOnly:  true,
+					Tmpfs:     map[string]string{"/tmp": "rw,size=64m"},
+					User:      "1000:1000",
+					CapDrop:   []string{"ALL"},
+					CapAdd:    []string{"NET_BIND_SERVICE"},
+					Ulimits:   []dagger.Ulimit{{Name: "nofile", Soft: 1024, Hard: 2048}},
+				},
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(config.User).To(Equal("1000:1000"))
+			Expect(config.HostConfig).To(Equal(dagger.HostConfig{
+				NanoCPUs:       1500000000,
+				PidsLimit:      100,
+				ReadonlyRootfs: true,
+				Tmpfs:          map[string]string{"/tmp": "rw,size=64m"},
+				CapAdd:         []string{"NET_BIND_SERVICE"},
+				CapDrop:        []string{"ALL"},
+				Ulimits:        []dagger.Ulimit{{Name: "nofile", Soft: 1024, Hard: 2048}},
+			}))
+		})
+
+		it("parses memory limits the way the docker CLI does", func() {
+			var config dagger.ContainerConfig
+			mux.HandleFunc("/containers/create", func(w http.ResponseWriter, req *http.Request) {
+				Expect(json.NewDecoder(req.Body).Decode(&config)).To(Succeed())
+				w.WriteHeader(http.StatusCreated)
+				w.Write([]byte(`{"Id": "some-id"}`))
+			})
+
+			runtime := dagger.NewDockerRuntime(client)
+			for memory, bytes := range map[string]int64{
+				"1048576": 1 << 20,
+				"512m":    512 << 20,
+				"512 M":   512 << 20,
+				"1gib":    1 << 30,
+				"1.5GB":   3 << 29,
+				"1t":      1 << 40,
+			} {
+				_, err := runtime.Create(context.Background(), dagger.RunConfig{Image: "some-image", Memory: memory})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(config.HostConfig.Memory).To(Equal(bytes), memory)
+			}
+
+			for _, memory := range []string{"-1m", "1x", "m", "1  m", "1.2.3g"} {
+				_, err := runtime.Create(context.Background(), dagger.RunConfig{Image: "some-image", Memory: memory})
+				Expect(err).To(MatchError(ContainSubstring("invalid memory value")), memory)
+			}
+		})
+
+		it("publishes ports on random host ports of every address by default", func() {
+			var config dagger.ContainerConfig
+			mux.HandleFunc("/containers/create", func(w http.ResponseWriter, req *http.Request) {
+				Expect(json.NewDecoder(req.Body).Decode(&config)).To(Succeed())
+				w.WriteHeader(http.StatusCreated)
+				w.Write([]byte(`{"Id": "some-id"}`))
+			})
+
+			_, err := dagger.NewDockerRuntime(client).Create(context.Background(), dagger.RunConfig{
+				Image: "some-image",
+				Ports: []string{"8080"},
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(config.HostConfig.PublishAllPorts).To(BeTrue())
+			Expect(config.HostConfig.PortBindings).To(Equal(map[string][]dagger.PortBinding{"8080/tcp": {{}}}))
+		})
+
+		it("publishes ports on the given host address only", func() {
+			var config dagger.ContainerConfig
+			mux.HandleFunc("/containers/create", func(w http.ResponseWriter, req *http.Request) {
+				Expect(json.NewDecoder(req.Body).Decode(&config)).To(Succeed())
+				w.WriteHeader(http.StatusCreated)
+				w.Write([]byte(`{"Id": "some-id"}`))
+			})
+
+			_, err := dagger.NewDockerRuntime(client).Create(context.Background(), dagger.RunConfig{
+				Image:  "some-image",
+				Ports:  []string{"5000"},
+				HostIP: "127.0.0.1",
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(config.HostConfig.PublishAllPorts).To(BeFalse())
+			Expect(config.HostConfig.PortBindings).To(Equal(map[string][]dagger.PortBinding{
+				"5000/tcp": {{HostIP: "127.0.0.1"}},
+			}))
+		})
+	})
+
+	when("reading container logs", func() {
+		it("demultiplexes stdout and stderr", func() {
+			mux.HandleFunc("/containers/some-id/logs", func(w http.ResponseWriter, req *http.Request) {
+				Expect(req.URL.Query().Get("stdout")).To(Equal("1"))
+				Expect(req.URL.Query().Get("stderr")).To(Equal("1"))
+				writeFrame(w, 1, "out line\n")
+				writeFrame(w, 2, "err line\n")
+			})
+
+			logs, err := client.ContainerLogs(context.Background(), "some-id", false)
+			Expect(err).NotTo(HaveOccurred())
+			defer logs.Close()
+
+			content, err := ioutil.ReadAll(logs)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(content)).To(Equal("out line\nerr line\n"))
+		})
+	})
+
+	when("running a command in a container", func() {
+		it("returns its output and exit code", func() {
+			var config dagger.ExecConfig
+			mux.HandleFunc("/containers/some-id/exec", func(w http.ResponseWriter, req *http.Request) {
+				Expect(json.NewDecoder(req.Body).Decode(&config)).To(Succeed())
+				w.WriteHeader(http.StatusCreated)
+				w.Write([]byte(`{"Id": "some-exec"}`))
+			})
+			mux.HandleFunc("/exec/some-exec/start", func(w http.ResponseWriter, req *http.Request) {
+				writeFrame(w, 1, "some-stdout")
+				writeFrame(w, 2, "some-stderr")
+			})
+			mux.HandleFunc("/exec/some-exec/json", func(w http.ResponseWriter, req *http.Request) {
+				w.Write([]byte(`{"ID": "some-exec", "Running": false, "ExitCode": 3}`))
+			})
+
+			result, err := dagger.NewDockerRuntime(client).Exec(context.Background(), "some-id", []string{"ls", "-l"}, dagger.ExecOptions{
+				User:       "cnb",
+				WorkingDir: "/workspace",
+				Env:        map[string]string{"SOME_VAR": "some-value"},
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result).To(Equal(dagger.ExecResult{Stdout: "some-stdout", Stderr: "some-stderr", ExitCode: 3}))
+
+			Expect(config.Cmd).To(Equal([]string{"ls", "-l"}))
+			Expect(config.User).To(Equal("cnb"))
+			Expect(config.WorkingDir).To(Equal("/workspace"))
+			Expect(config.Env).To(Equal([]string{"SOME_VAR=some-value"}))
+			Expect(config.AttachStdout).To(BeTrue())
+			Expect(config.AttachStderr).To(BeTrue())
+		})
+
+		it("returns once the app exec times out", func() {
+			mux.HandleFunc("/containers/some-id/exec", func(w http.ResponseWriter, req *http.Request) {
+				w.WriteHeader(http.StatusCreated)
+				w.Write([]byte(`{"Id": "some-exec"}`))
+			})
+			mux.HandleFunc("/exec/some-exec/start", func(w http.ResponseWriter, req *http.Request) {
+				w.WriteHeader(http.StatusOK)
+				w.(http.Flusher).Flush()
+				<-req.Context().Done()
+			})
+
+			app := dagger.NewApp("some-fixture", "some-image", "some-cache", nil, nil)
+			app.ContainerID = "some-id"
+			app.SetContainerRuntime(dagger.NewDockerRuntime(client))
+
+			started := time.Now()
+			_, err := app.Exec([]string{"sleep", "infinity"}, dagger.ExecOptions{Timeout: 200 * time.Millisecond})
+			Expect(err).To(MatchError(`timed out after 200ms running ["sleep" "infinity"] in container some-id`))
+			Expect(time.Since(started)).To(BeNumerically("<", 5*time.Second))
+		})
+	})
+
+	when("pulling an image", func() {
+		it("reports errors from the progress stream", func() {
+			mux.HandleFunc("/images/create", func(w http.ResponseWriter, req *http.Request) {
+				Expect(req.URL.Query().Get("fromImage")).To(Equal("registry:2"))
+				w.Write([]byte(`{"status": "Pulling from library/registry"}` + "\n"))
+				w.Write([]byte(`{"error": "manifest unknown"}` + "\n"))
+			})
+
+			err := client.ImagePull(context.Background(), "registry:2")
+			Expect(err).To(MatchError("failed to pull image registry:2: manifest unknown"))
+		})
+	})
+
+	when("checking whether an artifact exists", func() {
+		it("falls through containers, images and volumes", func() {
+			mux.HandleFunc("/containers/some-volume/json", func(w http.ResponseWriter, req *http.Request) {
+				w.WriteHeader(http.StatusNotFound)
+			})
+			mux.HandleFunc("/images/some-volume/json", func(w http.ResponseWriter, req *http.Request) {
+				w.WriteHeader(http.StatusNotFound)
+			})
+			mux.HandleFunc("/volumes/some-volume", func(w http.ResponseWriter, req *http.Request) {
+				w.Write([]byte(`{"Name": "some-volume"}`))
+			})
+
+			exists, err := client.Exists(context.Background(), "some-volume")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(exists).To(BeTrue())
+			Expect(requests).To(HaveLen(3))
+		})
+
+		it("returns false when nothing matches", func() {
+			exists, err := client.Exists(context.Background(), "nothing")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(exists).To(BeFalse())
+		})
+
+		it("returns daemon errors", func() {
+			mux.HandleFunc("/containers/broken/json", func(w http.ResponseWriter, req *http.Request) {
+				w.WriteHeader(http.StatusInternalServerError)
+				w.Write([]byte(`{"message": "daemon exploded"}`))
+			})
+
+			_, err := client.Exists(context.Background(), "broken")
+			Expect(err).To(MatchError(ContainSubstring("daemon exploded")))
+		})
+	})
+}
+
+func writeFrame(w http.ResponseWriter, stream byte, content string) {
+	header := make([]byte, 8)
+	header[0] = stream
+	binary.BigEndian.PutUint32(header[4:], uint32(len(content)))
+	w.Write(header)
+	w.Write([]byte(content))
+}
@@ -0,0 +1,59 @@
+package dagger
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// ExecOptions configure a command run inside a started app container.
+type ExecOptions struct {
+	User       string
+	WorkingDir string
+	Env        map[string]string
+
+	// Timeout bounds how long Exec waits for the command. Zero means no
+	// limit. Neither the Docker Engine API nor podman can stop a command run
+	// this way, so one that times out keeps running until it exits or the
+	// container is destroyed; commands that may hang are better bounded
+	// inside the container too, for example with timeout(1).
+	Timeout time.Duration
+}
+
+// ExecResult is the outcome of a command run inside an app container. A
+// non-zero ExitCode is not treated as an error.
+type ExecResult struct {
+	Stdout   string
+	Stderr   string
+	ExitCode int
+}
+
+// Exec runs cmd inside the started app container.
+func (a *App) Exec(cmd []string, options ExecOptions) (ExecResult, error) {
+	if len(cmd) == 0 {
+		return ExecResult{}, fmt.Errorf("no command given to exec in container %s", a.ContainerID)
+	}
+
+	runtime, err := a.containerRuntime()
+	if err != nil {
+		return ExecResult{}, err
+	}
+
+	ctx := context.Background()
+	if options.Timeout != 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, options.Timeout)
+		defer cancel()
+	}
+
+	result, err := runtime.Exec(ctx, a.ContainerID, cmd, options)
+	if err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			return result, fmt.Errorf("timed out after %s running %q in container %s", options.Timeout, cmd, a.ContainerID)
+		}
+
+		return result, err
+	}
+
+	return result, nil
+}
@@ -2,10 +2,23 @@ package main
 
 import (
 	"fmt"
+	"io/ioutil"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 )
 
+// version is reported by `pack version`, and can be set at build time with
+// -ldflags "-X main.version=0.20.0".
+var version = "0.12.0"
+
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "version" {
+		fmt.Printf("%s+git-abcdef0.build-1\n", version)
+		return
+	}
+
 	fmt.Fprintf(os.Stdout, "Pack output on stdout\n")
 	fmt.Fprintf(os.Stderr, "Pack output on stderr\n")
 	fmt.Printf("Arguments: %v\n", os.Args)
@@ -16,4 +29,41 @@ func main() {
 	}
 
 	fmt.Printf("PWD: %s\n", workingDirectory)
+
+	for i, arg := range os.Args {
+		if (arg == "--config" || arg == "--builder-config") && i+1 < len(os.Args) {
+			config, err := ioutil.ReadFile(os.Args[i+1])
+			if err != nil {
+				panic(err)
+			}
+
+			fmt.Print(string(config))
+		}
+	}
+
+	// Lets tests script lifecycle output from the app directory
+	output, err := ioutil.ReadFile(".fake-pack-output")
+	if err == nil {
+		fmt.Print(string(output))
+	}
+
+	// Lets tests produce many small writes, one line at a time
+	lines, err := ioutil.ReadFile(".fake-pack-lines")
+	if err == nil {
+		count, err := strconv.Atoi(strings.TrimSpace(string(lines)))
+		if err != nil {
+			panic(err)
+		}
+
+		for i := 0; i < count; i++ {
+			fmt.Printf("Line %d\n", i)
+			time.Sleep(100 * time.Microsecond)
+		}
+	}
+
+	// Lets tests simulate a hung build
+	if _, err := os.Stat(".fake-pack-hang"); err == nil {
+		fmt.Println("Hanging...")
+		time.Sleep(time.Hour)
+	}
 }
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+)
+
+// rule scripts the reply to the invocations whose arguments start with Args.
+type rule struct {
+	Args []string `json:"args"`
+
+	// Times limits how many invocations the rule replies to, 0 is unlimited
+	Times      int    `json:"times"`
+	Stdout     string `json:"stdout"`
+	StdoutFile string `json:"stdout_file"`
+	Stderr     string `json:"stderr"`
+	ExitCode   int    `json:"exit_code"`
+	Hang       bool   `json:"hang"`
+}
+
+// The fake podman appends its arguments, as a JSON array, to the file named by
+// FAKE_PODMAN_CALLS and replies with the first matching rule of the JSON list
+// in FAKE_PODMAN_RULES. Invocations that match no rule succeed silently.
+func main() {
+	args := os.Args[1:]
+
+	calls, err := previousCalls()
+	if err != nil {
+		panic(err)
+	}
+
+	err = record(args)
+	if err != nil {
+		panic(err)
+	}
+
+	rules, err := loadRules()
+	if err != nil {
+		panic(err)
+	}
+
+	for _, rule := range rules {
+		if !hasPrefix(args, rule.Args) {
+			continue
+		}
+
+		if rule.Times > 0 && count(calls, rule.Args) >= rule.Times {
+			continue
+		}
+
+		reply(rule)
+	}
+}
+
+func reply(rule rule) {
+	if rule.StdoutFile != "" {
+		content, err := ioutil.ReadFile(rule.StdoutFile)
+		if err != nil {
+			panic(err)
+		}
+		os.Stdout.Write(content)
+	}
+
+	fmt.Fprint(os.Stdout, rule.Stdout)
+	fmt.Fprint(os.Stderr, rule.Stderr)
+
+	if rule.Hang {
+		time.Sleep(time.Hour)
+	}
+
+	os.Exit(rule.ExitCode)
+}
+
+func loadRules() ([]rule, error) {
+	path := os.Getenv("FAKE_PODMAN_RULES")
+	if path == "" {
+		return nil, nil
+	}
+
+	content, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var rules []rule
+	err = json.Unmarshal(content, &rules)
+	if err != nil {
+		return nil, err
+	}
+
+	return rules, nil
+}
+
+func previousCalls() ([][]string, error) {
+	path := os.Getenv("FAKE_PODMAN_CALLS")
+	if path == "" {
+		return nil, nil
+	}
+
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var calls [][]string
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		var call []string
+		err = json.Unmarshal(scanner.Bytes(), &call)
+		if err != nil {
+			return nil, err
+		}
+		calls = append(calls, call)
+	}
+
+	return calls, scanner.Err()
+}
+
+func record(args []string) error {
+	path := os.Getenv("FAKE_PODMAN_CALLS")
+	if path == "" {
+		return nil
+	}
+
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	line, err := json.Marshal(args)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintln(file, string(line))
+	return err
+}
+
+func count(calls [][]string, prefix []string) int {
+	var matches int
+	for _, call := range calls {
+		if hasPrefix(call, prefix) {
+			matches++
+		}
+	}
+
+	return matches
+}
+
+func hasPrefix(args, prefix []string) bool {
+	if len(prefix) > len(args) {
+		return false
+	}
+
+	return strings.Join(args[:len(prefix)], "\x00") == strings.Join(prefix, "\x00")
+}
@@ -0,0 +1,302 @@
+// Package runtime provides a fake dagger.ContainerRuntime for tests.
+package runtime
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cloudfoundry/dagger"
+)
+
+var _ dagger.ContainerRuntime = &ContainerRuntime{}
+
+// ContainerRuntime records the containers, images, volumes and networks it is
+// asked to manage. A method calls its Stub when one is set. Otherwise it
+// succeeds and returns the canned results below, or an empty result when
+// there are none.
+type ContainerRuntime struct {
+	mutex sync.Mutex
+
+	// ContainerID is the ID Run and Create return.
+	ContainerID string
+
+	// State is what Inspect returns.
+	State dagger.ContainerState
+
+	// ContainerLogs are returned by Logs and FollowLogs.
+	ContainerLogs string
+
+	// PortMappings are what Ports returns.
+	PortMappings []dagger.PortMapping
+
+	// Image is what InspectImage returns.
+	Image dagger.ImageJSON
+
+	// Existing are the names that Exists finds.
+	Existing []string
+
+	Runs            []dagger.RunConfig
+	Created         []dagger.RunConfig
+	Inspected       []string
+	Stopped         []string
+	Removed         []string
+	Pulled          []string
+	RemovedImages   []string
+	RemovedVolumes  []string
+	Networks        []string
+	RemovedNetworks []string
+
+	RunStub            func(ctx context.Context, config dagger.RunConfig) (string, error)
+	CreateStub         func(ctx context.Context, config dagger.RunConfig) (string, error)
+	ContainersFromStub func(ctx context.Context, image string, since time.Time) ([]dagger.ContainerSummary, error)
+	InspectStub        func(ctx context.Context, id string) (dagger.ContainerState, error)
+	LogsStub           func(ctx context.Context, id string) (string, error)
+	FollowLogsStub     func(ctx context.Context, id string) (io.ReadCloser, error)
+	ExecStub           func(ctx context.Context, id string, cmd []string, options dagger.ExecOptions) (dagger.ExecResult, error)
+	CopyFromStub       func(ctx context.Context, id, path string) (io.ReadCloser, error)
+	StopStub           func(ctx context.Context, id string) error
+	RemoveStub         func(ctx context.Context, id string) error
+	PortsStub          func(ctx context.Context, id string) ([]dagger.PortMapping, error)
+	ExistsStub         func(ctx context.Context, name string) (bool, error)
+	InspectImageStub   func(ctx context.Context, name string) (dagger.ImageJSON, error)
+	SaveImageStub      func(ctx context.Context, name string) (io.ReadCloser, error)
+	PullImageStub      func(ctx context.Context, name string) error
+	RemoveImageStub    func(ctx context.Context, name string) error
+	RemoveVolumeStub   func(ctx context.Context, name string) error
+	VolumesStub        func(ctx context.Context) ([]string, error)
+	PruneImagesStub    func(ctx context.Context) error
+	CreateNetworkStub  func(ctx context.Context, name string) error
+	RemoveNetworkStub  func(ctx context.Context, name string) error
+}
+
+func (f *ContainerRuntime) Run(ctx context.Context, config dagger.RunConfig) (string, error) {
+	f.mutex.Lock()
+	f.Runs = append(f.Runs, config)
+	f.mutex.Unlock()
+
+	if f.RunStub != nil {
+		return f.RunStub(ctx, config)
+	}
+
+	return f.ContainerID, nil
+}
+
+func (f *ContainerRuntime) Create(ctx context.Context, config dagger.RunConfig) (string, error) {
+	f.mutex.Lock()
+	f.Created = append(f.Created, config)
+	f.mutex.Unlock()
+
+	if f.CreateStub != nil {
+		return f.CreateStub(ctx, config)
+	}
+
+	return f.ContainerID, nil
+}
+
+func (f *ContainerRuntime) ContainersFrom(ctx context.Context, image string, since time.Time) ([]dagger.ContainerSummary, error) {
+	if f.ContainersFromStub != nil {
+		return f.ContainersFromStub(ctx, image, since)
+	}
+
+	return nil, nil
+}
+
+func (f *ContainerRuntime) Inspect(ctx context.Context, id string) (dagger.ContainerState, error) {
+	f.mutex.Lock()
+	f.Inspected = append(f.Inspected, id)
+	f.mutex.Unlock()
+
+	if f.InspectStub != nil {
+		return f.InspectStub(ctx, id)
+	}
+
+	return f.State, nil
+}
+
+func (f *ContainerRuntime) Logs(ctx context.Context, id string) (string, error) {
+	if f.LogsStub != nil {
+		return f.LogsStub(ctx, id)
+	}
+
+	return f.ContainerLogs, nil
+}
+
+func (f *ContainerRuntime) FollowLogs(ctx context.Context, id string) (io.ReadCloser, error) {
+	if f.FollowLogsStub != nil {
+		return f.FollowLogsStub(ctx, id)
+	}
+
+	return ioutil.NopCloser(strings.NewReader(f.ContainerLogs)), nil
+}
+
+func (f *ContainerRuntime) Exec(ctx context.Context, id string, cmd []string, options dagger.ExecOptions) (dagger.ExecResult, error) {
+	if f.ExecStub != nil {
+		return f.ExecStub(ctx, id, cmd, options)
+	}
+
+	return dagger.ExecResult{}, nil
+}
+
+// CopyFrom finds no files unless it is stubbed.
+func (f *ContainerRuntime) CopyFrom(ctx context.Context, id, path string) (io.ReadCloser, error) {
+	if f.CopyFromStub != nil {
+		return f.CopyFromStub(ctx, id, path)
+	}
+
+	return nil, &dagger.DockerAPIError{StatusCode: http.StatusNotFound, Message: "Could not find the file " + path}
+}
+
+func (f *ContainerRuntime) Stop(ctx context.Context, id string) error {
+	f.mutex.Lock()
+	f.Stopped = append(f.Stopped, id)
+	f.mutex.Unlock()
+
+	if f.StopStub != nil {
+		return f.StopStub(ctx, id)
+	}
+
+	return nil
+}
+
+func (f *ContainerRuntime) Remove(ctx context.Context, id string) error {
+	f.mutex.Lock()
+	f.Removed = append(f.Removed, id)
+	f.mutex.Unlock()
+
+	if f.RemoveStub != nil {
+		return f.RemoveStub(ctx, id)
+	}
+
+	return nil
+}
+
+func (f *ContainerRuntime) Ports(ctx context.Context, id string) ([]dagger.PortMapping, error) {
+	if f.PortsStub != nil {
+		return f.PortsStub(ctx, id)
+	}
+
+	return f.PortMappings, nil
+}
+
+func (f *ContainerRuntime) Exists(ctx context.Context, name string) (bool, error) {
+	if f.ExistsStub != nil {
+		return f.ExistsStub(ctx, name)
+	}
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	for _, existing := range f.Existing {
+		if existing == name {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+func (f *ContainerRuntime) InspectImage(ctx context.Context, name string) (dagger.ImageJSON, error) {
+	if f.InspectImageStub != nil {
+		return f.InspectImageStub(ctx, name)
+	}
+
+	return f.Image, nil
+}
+
+// SaveImage returns an empty archive unless it is stubbed.
+func (f *ContainerRuntime) SaveImage(ctx context.Context, name string) (io.ReadCloser, error) {
+	if f.SaveImageStub != nil {
+		return f.SaveImageStub(ctx, name)
+	}
+
+	archive := bytes.NewBuffer(nil)
+	err := tar.NewWriter(archive).Close()
+	if err != nil {
+		return nil, err
+	}
+
+	return ioutil.NopCloser(archive), nil
+}
+
+func (f *ContainerRuntime) PullImage(ctx context.Context, name string) error {
+	f.mutex.Lock()
+	f.Pulled = append(f.Pulled, name)
+	f.mutex.Unlock()
+
+	if f.PullImageStub != nil {
+		return f.PullImageStub(ctx, name)
+	}
+
+	return nil
+}
+
+func (f *ContainerRuntime) RemoveImage(ctx context.Context, name string) error {
+	f.mutex.Lock()
+	f.RemovedImages = append(f.RemovedImages, name)
+	f.mutex.Unlock()
+
+	if f.RemoveImageStub != nil {
+		return f.RemoveImageStub(ctx, name)
+	}
+
+	return nil
+}
+
+func (f *ContainerRuntime) RemoveVolume(ctx context.Context, name string) error {
+	f.mutex.Lock()
+	f.RemovedVolumes = append(f.RemovedVolumes, name)
+	f.mutex.Unlock()
+
+	if f.RemoveVolumeStub != nil {
+		return f.RemoveVolumeStub(ctx, name)
+	}
+
+	return nil
+}
+
+func (f *ContainerRuntime) Volumes(ctx context.Context) ([]string, error) {
+	if f.VolumesStub != nil {
+		return f.VolumesStub(ctx)
+	}
+
+	return nil, nil
+}
+
+func (f *ContainerRuntime) PruneImages(ctx context.Context) error {
+	if f.PruneImagesStub != nil {
+		return f.PruneImagesStub(ctx)
+	}
+
+	return nil
+}
+
+func (f *ContainerRuntime) CreateNetwork(ctx context.Context, name string) error {
+	f.mutex.Lock()
+	f.Networks = append(f.Networks, name)
+	f.mutex.Unlock()
+
+	if f.CreateNetworkStub != nil {
+		return f.CreateNetworkStub(ctx, name)
+	}
+
+	return nil
+}
+
+func (f *ContainerRuntime) RemoveNetwork(ctx context.Context, name string) error {
+	f.mutex.Lock()
+	f.RemovedNetworks = append(f.RemovedNetworks, name)
+	f.mutex.Unlock()
+
+	if f.RemoveNetworkStub != nil {
+		return f.RemoveNetworkStub(ctx, name)
+	}
+
+	return nil
+}
@@ -0,0 +1,436 @@
+package dagger
+
+import (
+	"archive/tar"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const maxSymlinkDepth = 10
+
+// FileInfo describes a file in the app image.
+type FileInfo struct {
+	Path       string
+	Mode       os.FileMode
+	Size       int64
+	UID        int
+	GID        int
+	Owner      string
+	Group      string
+	LinkTarget string
+}
+
+// ReadFile returns the contents of a file in the app image. Symlinks are
+// followed. It works whether or not the app has been started.
+func (a *App) ReadFile(containerPath string) ([]byte, error) {
+	var contents []byte
+	err := a.withFileSource(func(ctx context.Context, runtime ContainerRuntime, id string) error {
+		current := containerPath
+		for depth := 0; depth <= maxSymlinkDepth; depth++ {
+			target, err := readArchivedFile(ctx, runtime, id, current, &contents)
+			if err != nil {
+				return err
+			}
+
+			if target == "" {
+				return nil
+			}
+
+			if !path.IsAbs(target) {
+				target = path.Join(path.Dir(current), target)
+			}
+			current = target
+		}
+
+		return fmt.Errorf("too many levels of symbolic links reading %s", containerPath)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return contents, nil
+}
+
+// readArchivedFile reads a single file into contents, or returns the link
+// target when the file is a symlink.
+func readArchivedFile(ctx context.Context, runtime ContainerRuntime, id, containerPath string, contents *[]byte) (string, error) {
+	archive, err := runtime.CopyFrom(ctx, id, containerPath)
+	if err != nil {
+		return "", err
+	}
+	defer archive.Close()
+
+	tr := tar.NewReader(archive)
+	header, err := tr.Next()
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s from container %s: %w", containerPath, id, err)
+	}
+
+	switch header.Typeflag {
+	case tar.TypeSymlink:
+		return header.Linkname, nil
+	case tar.TypeDir:
+		return "", fmt.Errorf("%s is a directory", containerPath)
+	}
+
+	*contents, err = ioutil.ReadAll(tr)
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s from container %s: %w", containerPath, id, err)
+	}
+
+	return "", nil
+}
+
+// Stat describes a single file in the app image without following symlinks.
+// Missing files return an error wrapping os.ErrNotExist.
+func (a *App) Stat(containerPath string) (FileInfo, error) {
+	var info FileInfo
+	err := a.withFileSource(func(ctx context.Context, runtime ContainerRuntime, id string) error {
+		archive, err := runtime.CopyFrom(ctx, id, containerPath)
+		if err != nil {
+			return err
+		}
+		defer archive.Close()
+
+		header, err := tar.NewReader(archive).Next()
+		if err != nil {
+			return fmt.Errorf("failed to read %s from container %s: %w", containerPath, id, err)
+		}
+
+		info = fileInfo(path.Clean(containerPath), header)
+		return nil
+	})
+	if err != nil {
+		// podman only reports missing files in its error output
+		if IsNotFound(err) || strings.Contains(err.Error(), "no such file or directory") {
+			return FileInfo{}, fmt.Errorf("%s: %w", containerPath, os.ErrNotExist)
+		}
+
+		return FileInfo{}, err
+	}
+
+	return info, nil
+}
+
+// CopyFrom copies a file or directory from the app image into hostDir,
+// keeping its base name, like `docker cp` does.
+func (a *App) CopyFrom(containerPath, hostDir string) error {
+	return a.withFileSource(func(ctx context.Context, runtime ContainerRuntime, id string) error {
+		archive, err := runtime.CopyFrom(ctx, id, containerPath)
+		if err != nil {
+			return err
+		}
+		defer archive.Close()
+
+		return extractTar(archive, hostDir)
+	})
+}
+
+// Walk calls fn for root and every file below it in the app image, in
+// lexical order.
+func (a *App) Walk(root string, fn func(FileInfo) error) error {
+	var files []FileInfo
+	err := a.withFileSource(func(ctx context.Context, runtime ContainerRuntime, id string) error {
+		var err error
+		files, err = archivedFiles(ctx, runtime, id, root)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		err := fn(file)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// archivedFiles lists root and every file below it in a container, sorted by
+// path.
+func archivedFiles(ctx context.Context, runtime ContainerRuntime, id, root string) ([]FileInfo, error) {
+	archive, err := runtime.CopyFrom(ctx, id, root)
+	if err != nil {
+		return nil, err
+	}
+	defer archive.Close()
+
+	var files []FileInfo
+	tr := tar.NewReader(archive)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to walk %s in container %s: %w", root, id, err)
+		}
+
+		// Archive entries are named relative to the parent of root
+		files = append(files, fileInfo(path.Join(path.Dir(path.Clean(root)), header.Name), header))
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].Path < files[j].Path
+	})
+
+	return files, nil
+}
+
+// Glob returns the paths in the app image matching pattern, using the syntax
+// of path.Match. Only the directory below the pattern's first wildcard is
+// searched, so anchoring the pattern keeps it fast.
+func (a *App) Glob(pattern string) ([]string, error) {
+	if !path.IsAbs(pattern) {
+		return nil, fmt.Errorf("glob pattern must be an absolute path: %s", pattern)
+	}
+
+	_, err := path.Match(pattern, "")
+	if err != nil {
+		return nil, fmt.Errorf("invalid glob pattern %s: %w", pattern, err)
+	}
+
+	root := "/"
+	for _, segment := range strings.Split(strings.TrimPrefix(pattern, "/"), "/") {
+		if strings.ContainsAny(segment, `*?[\`) {
+			break
+		}
+		root = path.Join(root, segment)
+	}
+
+	var matches []string
+	err = a.Walk(root, func(file FileInfo) error {
+		if matched, _ := path.Match(pattern, file.Path); matched {
+			matches = append(matches, file.Path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return matches, nil
+}
+
+// FilesIn returns every path below root in the app image that contains
+// path.
+func (a *App) FilesIn(root, path string) ([]string, error) {
+	var files []string
+	err := a.Walk(root, func(file FileInfo) error {
+		if strings.Contains(file.Path, path) {
+			files = append(files, file.Path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return files, nil
+}
+
+// Files returns every path in the app image that contains path, the way
+// `find ./..` prints them from the working directory, such as
+// "./../workspace/server.js". The image is searched in a container that is
+// never started, so mounts such as /proc are left out.
+//
+// Deprecated: Files copies the whole file system of the image out of the
+// runtime on every call. Use FilesIn, Glob or Walk, which only copy the
+// directory they search.
+func (a *App) Files(path string) ([]string, error) {
+	runtime, err := a.containerRuntime()
+	if err != nil {
+		return []string{}, err
+	}
+
+	var found []FileInfo
+	err = withCreatedContainer(runtime, a.ImageName, func(ctx context.Context, runtime ContainerRuntime, id string) error {
+		found, err = archivedFiles(ctx, runtime, id, "/")
+		return err
+	})
+	if err != nil {
+		return []string{}, err
+	}
+
+	var files []string
+	for _, file := range found {
+		if strings.Contains(file.Path, path) {
+			files = append(files, "./.."+file.Path)
+		}
+	}
+
+	return files, nil
+}
+
+func fileInfo(containerPath string, header *tar.Header) FileInfo {
+	return FileInfo{
+		Path:       containerPath,
+		Mode:       header.FileInfo().Mode(),
+		Size:       header.Size,
+		UID:        header.Uid,
+		GID:        header.Gid,
+		Owner:      header.Uname,
+		Group:      header.Gname,
+		LinkTarget: header.Linkname,
+	}
+}
+
+// withFileSource runs fn against the started app container, or against a
+// container created, but never started, from the app image.
+func (a *App) withFileSource(fn func(ctx context.Context, runtime ContainerRuntime, id string) error) error {
+	runtime, err := a.containerRuntime()
+	if err != nil {
+		return err
+	}
+
+	if a.ContainerID != "" {
+		return fn(context.Background(), runtime, a.ContainerID)
+	}
+
+	return withCreatedContainer(runtime, a.ImageName, fn)
+}
+
+// withCreatedContainer runs fn against a container created, but never
+// started, from image, and removes the container again.
+func withCreatedContainer(runtime ContainerRuntime, image string, fn func(ctx context.Context, runtime ContainerRuntime, id string) error) error {
+	ctx := context.Background()
+	id, err := runtime.Create(ctx, RunConfig{Image: image})
+	if err != nil {
+		return fmt.Errorf("failed to create container from image %s: %w", image, err)
+	}
+	defer runtime.Remove(ctx, id)
+
+	return fn(ctx, runtime, id)
+}
+
+func extractTar(archive io.Reader, destination string) error {
+	destination, err := filepath.Abs(destination)
+	if err != nil {
+		return err
+	}
+
+	tr := tar.NewReader(archive)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read archive: %w", err)
+		}
+
+		target, err := extractTarget(destination, header.Name)
+		if err != nil {
+			return err
+		}
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			err = os.MkdirAll(target, header.FileInfo().Mode().Perm()|0700)
+		case tar.TypeSymlink:
+			err = replaceable(target)
+			if err == nil {
+				err = os.Symlink(header.Linkname, target)
+			}
+		case tar.TypeLink:
+			var source string
+			source, err = extractTarget(destination, header.Linkname)
+			if err == nil {
+				err = replaceable(target)
+			}
+			if err == nil {
+				err = os.Link(source, target)
+			}
+		case tar.TypeReg:
+			err = replaceable(target)
+			if err == nil {
+				err = writeFile(target, tr, header.FileInfo().Mode().Perm())
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// extractTarget returns where the archive entry name is extracted to. Entries
+// that lead out of destination, lexically or through a symlink extracted
+// before them, are rejected.
+func extractTarget(destination, name string) (string, error) {
+	target := filepath.Join(destination, filepath.FromSlash(name))
+	if target != destination && !strings.HasPrefix(target, destination+string(filepath.Separator)) {
+		return "", fmt.Errorf("archive entry %s escapes %s", name, destination)
+	}
+
+	relative, err := filepath.Rel(destination, filepath.Dir(target))
+	if err != nil {
+		return "", err
+	}
+
+	parent := destination
+	for _, part := range strings.Split(relative, string(filepath.Separator)) {
+		if part == "." {
+			continue
+		}
+
+		parent = filepath.Join(parent, part)
+		info, err := os.Lstat(parent)
+		if os.IsNotExist(err) {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+
+		if info.Mode()&os.ModeSymlink != 0 {
+			return "", fmt.Errorf("archive entry %s escapes %s through symlink %s", name, destination, parent)
+		}
+	}
+
+	return target, nil
+}
+
+// replaceable creates the parent directory of target and removes anything
+// but a directory in its place, so that writing target never follows a
+// symlink.
+func replaceable(target string) error {
+	err := os.MkdirAll(filepath.Dir(target), 0755)
+	if err != nil {
+		return err
+	}
+
+	info, err := os.Lstat(target)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if info.IsDir() {
+		return fmt.Errorf("cannot replace directory %s", target)
+	}
+
+	return os.Remove(target)
+}
+
+func writeFile(target string, content io.Reader, mode os.FileMode) error {
+	file, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	_, err = io.Copy(file, content)
+	return err
+}
@@ -0,0 +1,234 @@
+package dagger_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/cloudfoundry/dagger"
+	fakes "github.com/cloudfoundry/dagger/fakes/runtime"
+	"github.com/sclevine/spec"
+
+	. "github.com/onsi/gomega"
+)
+
+type tarEntry struct {
+	header  tar.Header
+	content string
+}
+
+// tarArchive returns entries as an archive, like the runtime copies them.
+func tarArchive(entries []tarEntry) io.ReadCloser {
+	buffer := bytes.NewBuffer(nil)
+	tw := tar.NewWriter(buffer)
+	for _, entry := range entries {
+		header := entry.header
+		header.Size = int64(len(entry.content))
+		Expect(tw.WriteHeader(&header)).To(Succeed())
+		_, err := tw.Write([]byte(entry.content))
+		Expect(err).NotTo(HaveOccurred())
+	}
+	Expect(tw.Close()).To(Succeed())
+
+	return ioutil.NopCloser(buffer)
+}
+
+func testFiles(t *testing.T, when spec.G, it spec.S) {
+	var (
+		app      dagger.App
+		runtime  *fakes.ContainerRuntime
+		copiedID string
+	)
+
+	it.Before(func() {
+		archives := map[string][]tarEntry{
+			"/workspace": {
+				{header: tar.Header{Name: "workspace", Typeflag: tar.TypeDir, Mode: 0755, Uid: 1000, Gid: 1000, Uname: "cnb", Gname: "cnb"}},
+				{header: tar.Header{Name: "workspace/server.js", Typeflag: tar.TypeReg, Mode: 0644, Uid: 1000, Gid: 1000, Uname: "cnb", Gname: "cnb"}, content: "some-server"},
+				{header: tar.Header{Name: "workspace/lib/util.js", Typeflag: tar.TypeReg, Mode: 0600, Uid: 0, Gid: 0, Uname: "root", Gname: "root"}, content: "some-util"},
+			},
+			"/workspace/server.js": {
+				{header: tar.Header{Name: "server.js", Typeflag: tar.TypeReg, Mode: 0644}, content: "some-server"},
+			},
+			"/workspace/current": {
+				{header: tar.Header{Name: "current", Typeflag: tar.TypeSymlink, Linkname: "server.js"}},
+			},
+			"/": {
+				{header: tar.Header{Name: "/", Typeflag: tar.TypeDir, Mode: 0755}},
+				{header: tar.Header{Name: "etc/hosts", Typeflag: tar.TypeReg, Mode: 0644}},
+				{header: tar.Header{Name: "workspace/server.js", Typeflag: tar.TypeReg, Mode: 0644}, content: "some-server"},
+				{header: tar.Header{Name: "workspace/lib/util.js", Typeflag: tar.TypeReg, Mode: 0600}, content: "some-util"},
+			},
+		}
+
+		runtime = &fakes.ContainerRuntime{ContainerID: "created-id"}
+		runtime.CopyFromStub = func(ctx context.Context, id, path string) (io.ReadCloser, error) {
+			copiedID = id
+			return tarArchive(archives[path]), nil
+		}
+
+		app = dagger.NewApp("some-fixture", "some-image", "some-cache", bytes.NewBuffer(nil), map[string]string{})
+		app.SetContainerRuntime(runtime)
+	})
+
+	when("the app has not been started", func() {
+		it("reads files from a container created from the image", func() {
+			contents, err := app.ReadFile("/workspace/server.js")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(contents)).To(Equal("some-server"))
+
+			Expect(runtime.Created).To(Equal([]dagger.RunConfig{{Image: "some-image"}}))
+			Expect(copiedID).To(Equal("created-id"))
+			Expect(runtime.Removed).To(Equal([]string{"created-id"}))
+		})
+	})
+
+	when("the app has been started", func() {
+		it("reads files from the running container", func() {
+			app.ContainerID = "running-id"
+
+			_, err := app.ReadFile("/workspace/server.js")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(runtime.Created).To(BeEmpty())
+			Expect(copiedID).To(Equal("running-id"))
+		})
+	})
+
+	it("follows symlinks when reading files", func() {
+		contents, err := app.ReadFile("/workspace/current")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(contents)).To(Equal("some-server"))
+	})
+
+	it("walks files with their modes and owners", func() {
+		var files []dagger.FileInfo
+		Expect(app.Walk("/workspace", func(file dagger.FileInfo) error {
+			files = append(files, file)
+			return nil
+		})).To(Succeed())
+
+		Expect(files).To(HaveLen(3))
+		Expect(files[0].Path).To(Equal("/workspace"))
+		Expect(files[0].Mode.IsDir()).To(BeTrue())
+		Expect(files[1]).To(Equal(dagger.FileInfo{Path: "/workspace/lib/util.js", Mode: 0600, Size: 9, Owner: "root", Group: "root"}))
+		Expect(files[2]).To(Equal(dagger.FileInfo{Path: "/workspace/server.js", Mode: 0644, Size: 11, UID: 1000, GID: 1000, Owner: "cnb", Group: "cnb"}))
+	})
+
+	it("finds files matching a glob", func() {
+		matches, err := app.Glob("/workspace/*.js")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(matches).To(Equal([]string{"/workspace/server.js"}))
+	})
+
+	it("copies directories to the host", func() {
+		hostDir, err := ioutil.TempDir("", "copy")
+		Expect(err).NotTo(HaveOccurred())
+		defer os.RemoveAll(hostDir)
+
+		Expect(app.CopyFrom("/workspace", hostDir)).To(Succeed())
+
+		contents, err := ioutil.ReadFile(filepath.Join(hostDir, "workspace", "lib", "util.js"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(strings.TrimSpace(string(contents))).To(Equal("some-util"))
+	})
+
+	when("copying archives with links", func() {
+		var (
+			hostDir    string
+			outsideDir string
+			archive    []tarEntry
+		)
+
+		it.Before(func() {
+			var err error
+			hostDir, err = ioutil.TempDir("", "copy")
+			Expect(err).NotTo(HaveOccurred())
+
+			outsideDir, err = ioutil.TempDir("", "outside")
+			Expect(err).NotTo(HaveOccurred())
+
+			runtime.CopyFromStub = func(ctx context.Context, id, path string) (io.ReadCloser, error) {
+				return tarArchive(archive), nil
+			}
+		})
+
+		it.After(func() {
+			Expect(os.RemoveAll(hostDir)).To(Succeed())
+			Expect(os.RemoveAll(outsideDir)).To(Succeed())
+		})
+
+		it("extracts hard links as links to the files extracted before", func() {
+			archive = []tarEntry{
+				{header: tar.Header{Name: "workspace/server.js", Typeflag: tar.TypeReg, Mode: 0644}, content: "some-server"},
+				{header: tar.Header{Name: "workspace/index.js", Typeflag: tar.TypeLink, Linkname: "workspace/server.js"}},
+			}
+
+			Expect(app.CopyFrom("/workspace", hostDir)).To(Succeed())
+
+			original, err := os.Stat(filepath.Join(hostDir, "workspace", "server.js"))
+			Expect(err).NotTo(HaveOccurred())
+
+			link, err := os.Stat(filepath.Join(hostDir, "workspace", "index.js"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(os.SameFile(original, link)).To(BeTrue())
+		})
+
+		it("does not write through symlinks extracted before", func() {
+			archive = []tarEntry{
+				{header: tar.Header{Name: "workspace/escape", Typeflag: tar.TypeSymlink, Linkname: outsideDir}},
+				{header: tar.Header{Name: "workspace/escape/pwned", Typeflag: tar.TypeReg, Mode: 0644}, content: "pwned"},
+			}
+
+			err := app.CopyFrom("/workspace", hostDir)
+			Expect(err).To(MatchError(ContainSubstring("archive entry workspace/escape/pwned escapes")))
+			Expect(filepath.Join(outsideDir, "pwned")).NotTo(BeAnExistingFile())
+		})
+
+		it("replaces symlinks instead of writing to their target", func() {
+			outsideFile := filepath.Join(outsideDir, "some-file")
+			Expect(ioutil.WriteFile(outsideFile, []byte("untouched"), 0644)).To(Succeed())
+
+			archive = []tarEntry{
+				{header: tar.Header{Name: "workspace/file", Typeflag: tar.TypeSymlink, Linkname: outsideFile}},
+				{header: tar.Header{Name: "workspace/file", Typeflag: tar.TypeReg, Mode: 0644}, content: "some-content"},
+			}
+
+			Expect(app.CopyFrom("/workspace", hostDir)).To(Succeed())
+			Expect(ioutil.ReadFile(outsideFile)).To(Equal([]byte("untouched")))
+			Expect(ioutil.ReadFile(filepath.Join(hostDir, "workspace", "file"))).To(Equal([]byte("some-content")))
+		})
+
+		it("rejects hard links to files outside the host dir", func() {
+			archive = []tarEntry{
+				{header: tar.Header{Name: "workspace/passwd", Typeflag: tar.TypeLink, Linkname: "../../etc/passwd"}},
+			}
+
+			err := app.CopyFrom("/workspace", hostDir)
+			Expect(err).To(MatchError(ContainSubstring("archive entry ../../etc/passwd escapes")))
+		})
+	})
+
+	it("finds files below a directory that contain a path", func() {
+		files, err := app.FilesIn("/workspace", "lib")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(files).To(Equal([]string{"/workspace/lib/util.js"}))
+	})
+
+	it("finds files in the whole image the way find did", func() {
+		app.ContainerID = "running-id"
+
+		files, err := app.Files(".js")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(files).To(Equal([]string{"./../workspace/lib/util.js", "./../workspace/server.js"}))
+
+		Expect(runtime.Created).To(Equal([]dagger.RunConfig{{Image: "some-image"}}))
+		Expect(copiedID).To(Equal("created-id"))
+		Expect(runtime.Removed).To(Equal([]string{"created-id"}))
+	})
+}
@@ -1,6 +1,7 @@
 module github.com/cloudfoundry/dagger
 
 require (
+	github.com/BurntSushi/toml v0.4.1
 	github.com/buildpack/libbuildpack v1.25.11
 	github.com/cloudfoundry/libcfbuildpack v1.91.23
 	github.com/google/go-github v17.0.0+incompatible
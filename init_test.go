@@ -12,6 +12,10 @@ import (
 	"github.com/sclevine/spec/report"
 )
 
+// hostPath is $PATH before the fakes replace it, which is needed to build
+// more of them.
+var hostPath = os.Getenv("PATH")
+
 func TestUnitCloudNative(t *testing.T) {
 	suite := spec.New("cloudnative", spec.Report(report.Terminal{}))
 
@@ -44,7 +48,22 @@ func TestUnitCloudNative(t *testing.T) {
 		gexec.CleanupBuildArtifacts()
 	})
 
+	suite("App", testApp)
+	suite("Request", testRequest)
+	suite("Readiness", testReadiness)
 	suite("Pack", testPack)
+	suite("DockerClient", testDockerClient)
+	suite("ContainerRuntime", testContainerRuntime)
+	suite("PodmanRuntime", testPodmanRuntime)
+	suite("Logs", testLogs)
+	suite("Files", testFiles)
+	suite("Metadata", testMetadata)
+	suite("Layers", testLayers)
+	suite("BuildLog", testBuildLog)
+	suite("Detect", testDetect)
+	suite("Service", testService)
+	suite("Builder", testBuilder)
+	suite("Registry", testRegistry)
 
 	suite.Run(t)
 }
@@ -0,0 +1,206 @@
+package dagger
+
+import (
+	"archive/tar"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path"
+	"sort"
+	"sync"
+)
+
+var (
+	layerSizes      = map[string]map[string]int64{}
+	layerSizesMutex sync.Mutex
+)
+
+// Layer is a layer contributed by a buildpack to the app image. Layers that
+// are not launch layers are not part of the image and have no DiffID or Size.
+type Layer struct {
+	Name     string
+	Build    bool
+	Launch   bool
+	Cache    bool
+	Metadata map[string]interface{}
+	DiffID   string
+	Size     int64
+}
+
+// Layers returns the layers of the app image keyed by the ID of the
+// buildpack that contributed them, sorted by layer name. Layer sizes are
+// read from a saved copy of the image the first time an image ID is seen.
+func (a *App) Layers() (map[string][]Layer, error) {
+	metadata, err := a.Metadata()
+	if err != nil {
+		return nil, err
+	}
+
+	runtime, err := a.containerRuntime()
+	if err != nil {
+		return nil, err
+	}
+
+	sizes, err := cachedLayerSizes(context.Background(), runtime, a.ImageName)
+	if err != nil {
+		return nil, err
+	}
+
+	layers := map[string][]Layer{}
+	for _, buildpack := range metadata.Lifecycle.Buildpacks {
+		layers[buildpack.ID] = []Layer{}
+		for name, layer := range buildpack.Layers {
+			layers[buildpack.ID] = append(layers[buildpack.ID], Layer{
+				Name:     name,
+				Build:    layer.Build,
+				Launch:   layer.Launch,
+				Cache:    layer.Cache,
+				Metadata: layer.Data,
+				DiffID:   layer.SHA,
+				Size:     sizes[layer.SHA],
+			})
+		}
+
+		sort.Slice(layers[buildpack.ID], func(i, j int) bool {
+			return layers[buildpack.ID][i].Name < layers[buildpack.ID][j].Name
+		})
+	}
+
+	return layers, nil
+}
+
+// Layer returns a single layer contributed by a buildpack.
+func (a *App) Layer(buildpackID, name string) (Layer, error) {
+	layers, err := a.Layers()
+	if err != nil {
+		return Layer{}, err
+	}
+
+	buildpackLayers, ok := layers[buildpackID]
+	if !ok {
+		return Layer{}, fmt.Errorf("buildpack %s contributed no layers to image %s", buildpackID, a.ImageName)
+	}
+
+	for _, layer := range buildpackLayers {
+		if layer.Name == name {
+			return layer, nil
+		}
+	}
+
+	return Layer{}, fmt.Errorf("buildpack %s contributed no layer %s to image %s", buildpackID, name, a.ImageName)
+}
+
+// cachedLayerSizes returns the imageLayerSizes of image, which are only read
+// once per image ID since saving a large image takes a while.
+func cachedLayerSizes(ctx context.Context, runtime ContainerRuntime, image string) (map[string]int64, error) {
+	inspected, err := runtime.InspectImage(ctx, image)
+	if err != nil {
+		return nil, err
+	}
+
+	layerSizesMutex.Lock()
+	sizes, ok := layerSizes[inspected.ID]
+	layerSizesMutex.Unlock()
+	if ok {
+		return sizes, nil
+	}
+
+	sizes, err = imageLayerSizes(ctx, runtime, image)
+	if err != nil {
+		return nil, err
+	}
+
+	if inspected.ID != "" {
+		layerSizesMutex.Lock()
+		layerSizes[inspected.ID] = sizes
+		layerSizesMutex.Unlock()
+	}
+
+	return sizes, nil
+}
+
+// imageLayerSizes maps the diff IDs of an image to the uncompressed size of
+// each layer, read from the image's `docker save` tarball. The layer files
+// listed in manifest.json line up with the diff IDs of the image config.
+func imageLayerSizes(ctx context.Context, runtime ContainerRuntime, image string) (map[string]int64, error) {
+	archive, err := runtime.SaveImage(ctx, image)
+	if err != nil {
+		return nil, err
+	}
+	defer archive.Close()
+
+	sizes := map[string]int64{}
+	links := map[string]string{}
+	files := map[string][]byte{}
+
+	tr := tar.NewReader(archive)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read saved image %s: %w", image, err)
+		}
+
+		name := path.Clean(header.Name)
+		if header.Typeflag == tar.TypeSymlink {
+			links[name] = path.Join(path.Dir(name), header.Linkname)
+			continue
+		}
+
+		sizes[name] = header.Size
+
+		// Small files include manifest.json and the image config, which can
+		// only be told apart from layers by reading the manifest
+		if header.Size < 1<<20 {
+			files[name], err = ioutil.ReadAll(tr)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read saved image %s: %w", image, err)
+			}
+		}
+	}
+
+	var manifest []struct {
+		Config string   `json:"Config"`
+		Layers []string `json:"Layers"`
+	}
+
+	err = json.Unmarshal(files["manifest.json"], &manifest)
+	if err != nil || len(manifest) == 0 {
+		return nil, fmt.Errorf("failed to parse manifest.json of saved image %s", image)
+	}
+
+	var config struct {
+		RootFS struct {
+			DiffIDs []string `json:"diff_ids"`
+		} `json:"rootfs"`
+	}
+
+	err = json.Unmarshal(files[path.Clean(manifest[0].Config)], &config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse config of saved image %s: %w", image, err)
+	}
+
+	if len(config.RootFS.DiffIDs) != len(manifest[0].Layers) {
+		return nil, fmt.Errorf("saved image %s lists %d layers but %d diff IDs", image, len(manifest[0].Layers), len(config.RootFS.DiffIDs))
+	}
+
+	diffIDSizes := map[string]int64{}
+	for i, layer := range manifest[0].Layers {
+		name := path.Clean(layer)
+		for depth := 0; depth < maxSymlinkDepth; depth++ {
+			target, ok := links[name]
+			if !ok {
+				break
+			}
+			name = target
+		}
+
+		diffIDSizes[config.RootFS.DiffIDs[i]] = sizes[name]
+	}
+
+	return diffIDSizes, nil
+}
@@ -0,0 +1,108 @@
+package dagger_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/cloudfoundry/dagger"
+	fakes "github.com/cloudfoundry/dagger/fakes/runtime"
+	"github.com/sclevine/spec"
+
+	. "github.com/onsi/gomega"
+)
+
+func testLayers(t *testing.T, when spec.G, it spec.S) {
+	var (
+		app     dagger.App
+		runtime *fakes.ContainerRuntime
+		saves   int
+	)
+
+	it.Before(func() {
+		runtime = &fakes.ContainerRuntime{}
+		runtime.Image.Config.Labels = map[string]string{
+			dagger.LifecycleMetadataLabel: `{
+				"buildpacks": [
+					{
+						"key": "some-buildpack",
+						"version": "1.2.3",
+						"layers": {
+							"some-layer": {"sha": "sha256:second", "data": {"version": "1.0"}, "launch": true},
+							"another-layer": {"sha": "sha256:first", "launch": true, "cache": true}
+						}
+					},
+					{
+						"key": "other-buildpack",
+						"version": "4.5.6",
+						"layers": {"cache-layer": {"build": true, "cache": true}}
+					}
+				]
+			}`,
+		}
+
+		buffer := bytes.NewBuffer(nil)
+		tw := tar.NewWriter(buffer)
+		writeTarFile(tw, "manifest.json", `[{"Config": "config.json", "Layers": ["aaa/layer.tar", "bbb/layer.tar", "ccc/layer.tar"]}]`)
+		writeTarFile(tw, "config.json", `{"rootfs": {"type": "layers", "diff_ids": ["sha256:base", "sha256:first", "sha256:second"]}}`)
+		writeTarFile(tw, "aaa/layer.tar", "base-layer")
+		writeTarFile(tw, "bbb/layer.tar", "first")
+		Expect(tw.WriteHeader(&tar.Header{Name: "ccc/layer.tar", Typeflag: tar.TypeSymlink, Linkname: "../bbb/layer.tar"})).To(Succeed())
+		Expect(tw.Close()).To(Succeed())
+		saves = 0
+		runtime.SaveImageStub = func(ctx context.Context, name string) (io.ReadCloser, error) {
+			saves++
+			return ioutil.NopCloser(bytes.NewReader(buffer.Bytes())), nil
+		}
+
+		app = dagger.NewApp("some-fixture", "some-image", "some-cache", bytes.NewBuffer(nil), map[string]string{})
+		app.SetContainerRuntime(runtime)
+	})
+
+	it("lists the layers of each buildpack", func() {
+		layers, err := app.Layers()
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(layers).To(Equal(map[string][]dagger.Layer{
+			"some-buildpack": {
+				{Name: "another-layer", Launch: true, Cache: true, DiffID: "sha256:first", Size: 5},
+				{Name: "some-layer", Launch: true, Metadata: map[string]interface{}{"version": "1.0"}, DiffID: "sha256:second", Size: 5},
+			},
+			"other-buildpack": {
+				{Name: "cache-layer", Build: true, Cache: true},
+			},
+		}))
+	})
+
+	it("saves each image only once to find the layer sizes", func() {
+		runtime.Image.ID = fmt.Sprintf("sha256:%d", time.Now().UnixNano())
+
+		first, err := app.Layers()
+		Expect(err).NotTo(HaveOccurred())
+
+		second, err := app.Layers()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(second).To(Equal(first))
+		Expect(saves).To(Equal(1))
+	})
+
+	it("finds a single layer", func() {
+		layer, err := app.Layer("some-buildpack", "some-layer")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(layer.DiffID).To(Equal("sha256:second"))
+
+		_, err = app.Layer("some-buildpack", "missing-layer")
+		Expect(err).To(MatchError("buildpack some-buildpack contributed no layer missing-layer to image some-image"))
+	})
+}
+
+func writeTarFile(tw *tar.Writer, name, content string) {
+	Expect(tw.WriteHeader(&tar.Header{Name: name, Typeflag: tar.TypeReg, Mode: 0644, Size: int64(len(content))})).To(Succeed())
+	_, err := tw.Write([]byte(content))
+	Expect(err).NotTo(HaveOccurred())
+}
@@ -0,0 +1,227 @@
+package dagger
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// LogFollower streams the output of an app container while it runs. Every
+// line seen since the follower started is kept, so lines written before a
+// caller started watching are not missed.
+type LogFollower struct {
+	cancel   context.CancelFunc
+	stopped  chan struct{}
+	done     chan struct{}
+	mutex    sync.Mutex
+	cond     *sync.Cond
+	lines    []string
+	finished bool
+	err      error
+}
+
+func newLogFollower(ctx context.Context, runtime ContainerRuntime, id string) (*LogFollower, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	logs, err := runtime.FollowLogs(ctx, id)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	follower := &LogFollower{
+		cancel:  cancel,
+		stopped: make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	follower.cond = sync.NewCond(&follower.mutex)
+
+	go follower.pump(ctx, logs)
+
+	return follower, nil
+}
+
+func (f *LogFollower) pump(ctx context.Context, logs io.ReadCloser) {
+	defer close(f.done)
+	defer logs.Close()
+
+	scanner := bufio.NewScanner(logs)
+	scanner.Buffer(make([]byte, 0, bufio.MaxScanTokenSize), 1024*1024)
+	for scanner.Scan() {
+		f.mutex.Lock()
+		f.lines = append(f.lines, stripColor(scanner.Text()))
+		f.mutex.Unlock()
+		f.cond.Broadcast()
+	}
+
+	f.mutex.Lock()
+	f.finished = true
+	if ctx.Err() == nil {
+		f.err = scanner.Err()
+	}
+	f.mutex.Unlock()
+	f.cond.Broadcast()
+}
+
+// Lines returns a channel that replays every line seen so far and then
+// delivers new lines as they are written. It is closed once the container
+// stops writing or the follower is stopped.
+func (f *LogFollower) Lines() <-chan string {
+	return f.follow(nil)
+}
+
+// follow is Lines, which also ends once done is closed by release.
+func (f *LogFollower) follow(done <-chan struct{}) <-chan string {
+	lines := make(chan string)
+	go func() {
+		defer close(lines)
+		for i := 0; ; i++ {
+			f.mutex.Lock()
+			for i >= len(f.lines) && !f.finished && !isClosed(done) {
+				f.cond.Wait()
+			}
+
+			if i >= len(f.lines) || isClosed(done) {
+				f.mutex.Unlock()
+				return
+			}
+
+			line := f.lines[i]
+			f.mutex.Unlock()
+
+			select {
+			case lines <- line:
+			case <-f.stopped:
+				return
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return lines
+}
+
+// release ends the channel returned by follow for done.
+func (f *LogFollower) release(done chan struct{}) {
+	f.mutex.Lock()
+	close(done)
+	f.mutex.Unlock()
+	f.cond.Broadcast()
+}
+
+func isClosed(done <-chan struct{}) bool {
+	select {
+	case <-done:
+		return true
+	default:
+		return false
+	}
+}
+
+// String returns the output seen so far.
+func (f *LogFollower) String() string {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if len(f.lines) == 0 {
+		return ""
+	}
+
+	return strings.Join(f.lines, "\n") + "\n"
+}
+
+// Match returns the first line seen so far that matches pattern.
+func (f *LogFollower) Match(pattern *regexp.Regexp) (string, bool) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	for _, line := range f.lines {
+		if pattern.MatchString(line) {
+			return line, true
+		}
+	}
+
+	return "", false
+}
+
+// Err returns the error that ended the stream, if any.
+func (f *LogFollower) Err() error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	return f.err
+}
+
+// Stop ends the stream and waits for it to be released.
+func (f *LogFollower) Stop() {
+	select {
+	case <-f.stopped:
+		return
+	default:
+	}
+
+	close(f.stopped)
+	f.cancel()
+	<-f.done
+
+	f.mutex.Lock()
+	f.finished = true
+	f.mutex.Unlock()
+	f.cond.Broadcast()
+}
+
+// FollowLogs starts streaming the app container output. Calling it again
+// returns the same follower; Destroy stops it.
+func (a *App) FollowLogs() (*LogFollower, error) {
+	if a.logFollower != nil {
+		return a.logFollower, nil
+	}
+
+	runtime, err := a.containerRuntime()
+	if err != nil {
+		return nil, err
+	}
+
+	a.logFollower, err = newLogFollower(context.Background(), runtime, a.ContainerID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to follow logs of container %s: %w", a.ContainerID, err)
+	}
+
+	return a.logFollower, nil
+}
+
+// WaitForLog blocks until the app logs a line matching pattern and returns
+// that line.
+func (a *App) WaitForLog(pattern *regexp.Regexp, timeout time.Duration) (string, error) {
+	follower, err := a.FollowLogs()
+	if err != nil {
+		return "", err
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	done := make(chan struct{})
+	defer follower.release(done)
+
+	lines := follower.follow(done)
+	for {
+		select {
+		case line, ok := <-lines:
+			if !ok {
+				return "", fmt.Errorf("container %s stopped logging before a line matched %q:\n%s", a.ContainerID, pattern, follower.String())
+			}
+
+			if pattern.MatchString(line) {
+				return line, nil
+			}
+		case <-timer.C:
+			return "", fmt.Errorf("timed out after %s waiting for container %s to log a line matching %q:\n%s", timeout, a.ContainerID, pattern, follower.String())
+		}
+	}
+}
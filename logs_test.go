@@ -0,0 +1,98 @@
+package dagger_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"regexp"
+	goruntime "runtime"
+	"testing"
+	"time"
+
+	"github.com/cloudfoundry/dagger"
+	fakes "github.com/cloudfoundry/dagger/fakes/runtime"
+	"github.com/sclevine/spec"
+
+	. "github.com/onsi/gomega"
+)
+
+func testLogs(t *testing.T, when spec.G, it spec.S) {
+	var (
+		app  dagger.App
+		logs *io.PipeWriter
+	)
+
+	it.Before(func() {
+		runtime := &fakes.ContainerRuntime{}
+		runtime.FollowLogsStub = func(ctx context.Context, id string) (io.ReadCloser, error) {
+			reader, writer := io.Pipe()
+			logs = writer
+			go func() {
+				<-ctx.Done()
+				writer.CloseWithError(ctx.Err())
+			}()
+
+			return reader, nil
+		}
+
+		app = dagger.NewApp("some-fixture", "some-image", "some-cache", bytes.NewBuffer(nil), map[string]string{})
+		app.SetContainerRuntime(runtime)
+	})
+
+	when("waiting for a log line", func() {
+		it("returns lines written before and after it started waiting", func() {
+			follower, err := app.FollowLogs()
+			Expect(err).NotTo(HaveOccurred())
+			defer follower.Stop()
+
+			go func() {
+				io.WriteString(logs, "Starting application\n")
+				time.Sleep(10 * time.Millisecond)
+				io.WriteString(logs, "\x1b[32mStarted application in 1.2 seconds\x1b[0m\n")
+			}()
+
+			line, err := app.WaitForLog(regexp.MustCompile(`Started application in`), time.Second)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(line).To(Equal("Started application in 1.2 seconds"))
+
+			line, err = app.WaitForLog(regexp.MustCompile(`^Starting`), time.Second)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(line).To(Equal("Starting application"))
+		})
+
+		it("times out with the logs seen so far", func() {
+			follower, err := app.FollowLogs()
+			Expect(err).NotTo(HaveOccurred())
+			defer follower.Stop()
+
+			go io.WriteString(logs, "still booting\n")
+
+			_, err = app.WaitForLog(regexp.MustCompile(`never`), 100*time.Millisecond)
+			Expect(err).To(MatchError(ContainSubstring("timed out after 100ms")))
+			Expect(err).To(MatchError(ContainSubstring("still booting")))
+		})
+
+		it("releases what it waited with once it times out", func() {
+			follower, err := app.FollowLogs()
+			Expect(err).NotTo(HaveOccurred())
+			defer follower.Stop()
+
+			goroutines := goruntime.NumGoroutine()
+			for i := 0; i < 5; i++ {
+				_, err = app.WaitForLog(regexp.MustCompile(`never`), 10*time.Millisecond)
+				Expect(err).To(MatchError(ContainSubstring("timed out")))
+			}
+
+			Eventually(goruntime.NumGoroutine).Should(BeNumerically("<=", goroutines))
+		})
+
+		it("stops waiting once the follower is stopped", func() {
+			follower, err := app.FollowLogs()
+			Expect(err).NotTo(HaveOccurred())
+			follower.Stop()
+
+			_, err = app.WaitForLog(regexp.MustCompile(`never`), time.Second)
+			Expect(err).To(MatchError(ContainSubstring("stopped logging")))
+		})
+	})
+}
@@ -0,0 +1,79 @@
+package matchers
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/cloudfoundry/dagger"
+)
+
+// HaveBuildpackInGroupMatcher succeeds when a buildpack took part in building
+// the app image.
+type HaveBuildpackInGroupMatcher struct {
+	id         string
+	version    string
+	buildpacks []dagger.BuildpackInfo
+	app        *dagger.App
+}
+
+// HaveBuildpackInGroup matches a buildpack of the group that built the app.
+// An empty version matches any version.
+func HaveBuildpackInGroup(id, version string) *HaveBuildpackInGroupMatcher {
+	return &HaveBuildpackInGroupMatcher{
+		id:      id,
+		version: version,
+	}
+}
+
+func (m *HaveBuildpackInGroupMatcher) Match(actual interface{}) (bool, error) {
+	app, err := toApp(actual)
+	if err != nil {
+		return false, err
+	}
+	m.app = app
+
+	metadata, err := app.Metadata()
+	if err != nil {
+		return false, err
+	}
+	m.buildpacks = metadata.Build.Buildpacks
+
+	for _, buildpack := range m.buildpacks {
+		if buildpack.ID == m.id && (m.version == "" || buildpack.Version == m.version) {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+func (m *HaveBuildpackInGroupMatcher) FailureMessage(actual interface{}) string {
+	return fmt.Sprintf("Expected image %s to be built by buildpack %s, group was:\n%s%s",
+		m.app.ImageName, m.expected(), m.group(), appLogs(m.app))
+}
+
+func (m *HaveBuildpackInGroupMatcher) NegatedFailureMessage(actual interface{}) string {
+	return fmt.Sprintf("Expected image %s not to be built by buildpack %s, group was:\n%s%s",
+		m.app.ImageName, m.expected(), m.group(), appLogs(m.app))
+}
+
+func (m *HaveBuildpackInGroupMatcher) expected() string {
+	if m.version == "" {
+		return m.id
+	}
+
+	return fmt.Sprintf("%s@%s", m.id, m.version)
+}
+
+func (m *HaveBuildpackInGroupMatcher) group() string {
+	var lines []string
+	for _, buildpack := range m.buildpacks {
+		lines = append(lines, fmt.Sprintf("    %s@%s", buildpack.ID, buildpack.Version))
+	}
+
+	if len(lines) == 0 {
+		return "    <no buildpacks>"
+	}
+
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,47 @@
+package matchers
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/cloudfoundry/dagger"
+)
+
+// HaveFileMatcher succeeds when a path exists in the app image.
+type HaveFileMatcher struct {
+	path string
+	app  *dagger.App
+}
+
+func HaveFile(path string) *HaveFileMatcher {
+	return &HaveFileMatcher{
+		path: path,
+	}
+}
+
+func (m *HaveFileMatcher) Match(actual interface{}) (bool, error) {
+	app, err := toApp(actual)
+	if err != nil {
+		return false, err
+	}
+	m.app = app
+
+	_, err = app.Stat(m.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+func (m *HaveFileMatcher) FailureMessage(actual interface{}) string {
+	return fmt.Sprintf("Expected image %s to have file %s%s", m.app.ImageName, m.path, appLogs(m.app))
+}
+
+func (m *HaveFileMatcher) NegatedFailureMessage(actual interface{}) string {
+	return fmt.Sprintf("Expected image %s not to have file %s%s", m.app.ImageName, m.path, appLogs(m.app))
+}
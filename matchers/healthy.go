@@ -0,0 +1,35 @@
+package matchers
+
+import (
+	"fmt"
+
+	"github.com/cloudfoundry/dagger"
+)
+
+// BeHealthyMatcher succeeds when a started app is running and passes the
+// readiness check it was started with.
+type BeHealthyMatcher struct {
+	app *dagger.App
+}
+
+func BeHealthy() *BeHealthyMatcher {
+	return &BeHealthyMatcher{}
+}
+
+func (m *BeHealthyMatcher) Match(actual interface{}) (bool, error) {
+	app, err := toApp(actual)
+	if err != nil {
+		return false, err
+	}
+	m.app = app
+
+	return app.Ready()
+}
+
+func (m *BeHealthyMatcher) FailureMessage(actual interface{}) string {
+	return fmt.Sprintf("Expected container %s to be healthy%s", m.app.ContainerID, appLogs(m.app))
+}
+
+func (m *BeHealthyMatcher) NegatedFailureMessage(actual interface{}) string {
+	return fmt.Sprintf("Expected container %s not to be healthy%s", m.app.ContainerID, appLogs(m.app))
+}
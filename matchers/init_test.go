@@ -0,0 +1,21 @@
+package matchers_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+)
+
+func TestUnitMatchers(t *testing.T) {
+	suite := spec.New("matchers", spec.Report(report.Terminal{}))
+
+	suite.Before(func(t *testing.T) {
+		RegisterTestingT(t)
+	})
+
+	suite("Matchers", testMatchers)
+
+	suite.Run(t)
+}
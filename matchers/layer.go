@@ -0,0 +1,72 @@
+package matchers
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/cloudfoundry/dagger"
+)
+
+// ContainLayerMatcher succeeds when a buildpack contributed a layer to the
+// app image.
+type ContainLayerMatcher struct {
+	buildpackID string
+	name        string
+	layers      map[string][]dagger.Layer
+	app         *dagger.App
+}
+
+func ContainLayer(buildpackID, name string) *ContainLayerMatcher {
+	return &ContainLayerMatcher{
+		buildpackID: buildpackID,
+		name:        name,
+	}
+}
+
+func (m *ContainLayerMatcher) Match(actual interface{}) (bool, error) {
+	app, err := toApp(actual)
+	if err != nil {
+		return false, err
+	}
+	m.app = app
+
+	m.layers, err = app.Layers()
+	if err != nil {
+		return false, err
+	}
+
+	for _, layer := range m.layers[m.buildpackID] {
+		if layer.Name == m.name {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+func (m *ContainLayerMatcher) FailureMessage(actual interface{}) string {
+	return fmt.Sprintf("Expected image %s to contain layer %s:%s, found:\n%s%s",
+		m.app.ImageName, m.buildpackID, m.name, m.found(), appLogs(m.app))
+}
+
+func (m *ContainLayerMatcher) NegatedFailureMessage(actual interface{}) string {
+	return fmt.Sprintf("Expected image %s not to contain layer %s:%s%s",
+		m.app.ImageName, m.buildpackID, m.name, appLogs(m.app))
+}
+
+func (m *ContainLayerMatcher) found() string {
+	var names []string
+	for buildpackID, layers := range m.layers {
+		for _, layer := range layers {
+			names = append(names, fmt.Sprintf("    %s:%s", buildpackID, layer.Name))
+		}
+	}
+
+	if len(names) == 0 {
+		return "    <no layers>"
+	}
+
+	sort.Strings(names)
+	return strings.Join(names, "\n")
+}
@@ -0,0 +1,72 @@
+package matchers
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/cloudfoundry/dagger"
+	"github.com/onsi/gomega"
+	"github.com/onsi/gomega/types"
+)
+
+// HaveLoggedMatcher succeeds when logs match a pattern.
+type HaveLoggedMatcher struct {
+	expected types.GomegaMatcher
+	logs     string
+	app      *dagger.App
+}
+
+// HaveLogged matches the container logs of a started app, or any log string
+// such as the one returned by App.BuildLogs. The pattern may be a substring,
+// a *regexp.Regexp or a gomega matcher.
+func HaveLogged(pattern interface{}) *HaveLoggedMatcher {
+	var expected types.GomegaMatcher
+	switch p := pattern.(type) {
+	case types.GomegaMatcher:
+		expected = p
+	case *regexp.Regexp:
+		expected = gomega.MatchRegexp(p.String())
+	default:
+		expected = gomega.ContainSubstring(fmt.Sprint(p))
+	}
+
+	return &HaveLoggedMatcher{
+		expected: expected,
+	}
+}
+
+func (m *HaveLoggedMatcher) Match(actual interface{}) (bool, error) {
+	if logs, ok := actual.(string); ok {
+		m.logs = logs
+		return m.expected.Match(logs)
+	}
+
+	app, err := toApp(actual)
+	if err != nil {
+		return false, fmt.Errorf("HaveLogged expects a dagger.App or a string, got %s", typeOf(actual))
+	}
+	m.app = app
+
+	m.logs, err = app.Logs()
+	if err != nil {
+		return false, err
+	}
+
+	return m.expected.Match(m.logs)
+}
+
+func (m *HaveLoggedMatcher) FailureMessage(actual interface{}) string {
+	return m.message(m.expected.FailureMessage(m.logs))
+}
+
+func (m *HaveLoggedMatcher) NegatedFailureMessage(actual interface{}) string {
+	return m.message(m.expected.NegatedFailureMessage(m.logs))
+}
+
+func (m *HaveLoggedMatcher) message(failure string) string {
+	if m.app == nil {
+		return failure
+	}
+
+	return fmt.Sprintf("Container logs of %s:\n%s%s", m.app.ContainerID, failure, appLogs(m.app))
+}
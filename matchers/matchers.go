@@ -0,0 +1,46 @@
+// Package matchers provides gomega matchers for apps built by dagger. Failure
+// messages include the container and build logs of the app, which are usually
+// the first thing needed to understand why an expectation did not hold.
+package matchers
+
+import (
+	"fmt"
+
+	"github.com/cloudfoundry/dagger"
+)
+
+func toApp(actual interface{}) (*dagger.App, error) {
+	switch app := actual.(type) {
+	case *dagger.App:
+		if app != nil {
+			return app, nil
+		}
+	case dagger.App:
+		return &app, nil
+	}
+
+	return nil, fmt.Errorf("expected a dagger.App, got %s", typeOf(actual))
+}
+
+// typeOf describes the type of actual, or nil when there is no app to match.
+func typeOf(actual interface{}) string {
+	if app, ok := actual.(*dagger.App); actual == nil || ok && app == nil {
+		return "nil"
+	}
+
+	return fmt.Sprintf("%T", actual)
+}
+
+// appLogs formats the container and build logs of app for failure messages.
+func appLogs(app *dagger.App) string {
+	containerLogs := "<app not started>"
+	if app.ContainerID != "" {
+		logs, err := app.Logs()
+		if err != nil {
+			logs = fmt.Sprintf("<failed to get logs: %s>", err)
+		}
+		containerLogs = logs
+	}
+
+	return fmt.Sprintf("\n\nContainer logs:\n%s\n\nBuild logs:\n%s", containerLogs, app.BuildLogs())
+}
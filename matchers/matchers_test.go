@@ -0,0 +1,262 @@
+package matchers_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/cloudfoundry/dagger"
+	fakes "github.com/cloudfoundry/dagger/fakes/runtime"
+	"github.com/cloudfoundry/dagger/matchers"
+	"github.com/onsi/gomega/types"
+	"github.com/sclevine/spec"
+
+	. "github.com/onsi/gomega"
+)
+
+func testMatchers(t *testing.T, when spec.G, it spec.S) {
+	var (
+		app     dagger.App
+		runtime *fakes.ContainerRuntime
+	)
+
+	it.Before(func() {
+		runtime = &fakes.ContainerRuntime{ContainerLogs: "Listening on port 8080\n"}
+		runtime.CopyFromStub = func(ctx context.Context, id, path string) (io.ReadCloser, error) {
+			if path != "/workspace/server.js" {
+				return nil, &dagger.DockerAPIError{StatusCode: 404, Message: "Could not find the file " + path}
+			}
+
+			content := "listen()"
+			buffer := bytes.NewBuffer(nil)
+			tw := tar.NewWriter(buffer)
+			Expect(tw.WriteHeader(&tar.Header{Name: path, Mode: 0644, Size: int64(len(content))})).To(Succeed())
+			_, err := tw.Write([]byte(content))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(tw.Close()).To(Succeed())
+
+			return ioutil.NopCloser(buffer), nil
+		}
+		runtime.Image.Config.Labels = map[string]string{
+			dagger.LifecycleMetadataLabel: `{"buildpacks": []}`,
+			dagger.BuildMetadataLabel:     `{"buildpacks": [{"id": "paketo-buildpacks/node-engine", "version": "1.2.3"}]}`,
+		}
+
+		app = dagger.NewApp("some-fixture", "some-image", "some-cache", bytes.NewBufferString("some build output"), map[string]string{})
+		app.SetContainerRuntime(runtime)
+		app.ContainerID = "some-container"
+	})
+
+	when("HaveLogged", func() {
+		it("matches the container logs", func() {
+			Expect(app).To(matchers.HaveLogged("Listening"))
+			Expect(app).To(matchers.HaveLogged(regexp.MustCompile(`port \d+`)))
+			Expect(app).NotTo(matchers.HaveLogged("Error"))
+		})
+
+		it("matches log strings", func() {
+			Expect(app.BuildLogs()).To(matchers.HaveLogged("build output"))
+		})
+
+		it("includes the container and build logs in failure messages", func() {
+			matcher := matchers.HaveLogged("Error")
+			Expect(matcher.Match(&app)).To(BeFalse())
+
+			message := matcher.FailureMessage(&app)
+			Expect(message).To(ContainSubstring("Container logs:\nListening on port 8080"))
+			Expect(message).To(ContainSubstring("Build logs:\nsome build output"))
+		})
+	})
+
+	when("HaveFile", func() {
+		it("matches files in the app image", func() {
+			Expect(app).To(matchers.HaveFile("/workspace/server.js"))
+			Expect(app).NotTo(matchers.HaveFile("/workspace/missing.js"))
+		})
+	})
+
+	when("HaveBuildpackInGroup", func() {
+		it("matches buildpacks by id and version", func() {
+			Expect(app).To(matchers.HaveBuildpackInGroup("paketo-buildpacks/node-engine", "1.2.3"))
+			Expect(app).To(matchers.HaveBuildpackInGroup("paketo-buildpacks/node-engine", ""))
+			Expect(app).NotTo(matchers.HaveBuildpackInGroup("paketo-buildpacks/node-engine", "2.0.0"))
+			Expect(app).NotTo(matchers.HaveBuildpackInGroup("paketo-buildpacks/npm", ""))
+		})
+
+		it("lists the group in failure messages", func() {
+			matcher := matchers.HaveBuildpackInGroup("paketo-buildpacks/npm", "")
+			Expect(matcher.Match(&app)).To(BeFalse())
+			Expect(matcher.FailureMessage(&app)).To(ContainSubstring("paketo-buildpacks/node-engine@1.2.3"))
+		})
+	})
+
+	when("ContainLayer", func() {
+		it.Before(func() {
+			runtime.Image.Config.Labels[dagger.LifecycleMetadataLabel] = `{
+				"buildpacks": [{"key": "paketo-buildpacks/node-engine", "layers": {"node": {"launch": true}}}]
+			}`
+			runtime.SaveImageStub = func(ctx context.Context, name string) (io.ReadCloser, error) {
+				buffer := bytes.NewBuffer(nil)
+				tw := tar.NewWriter(buffer)
+				for name, content := range map[string]string{
+					"manifest.json": `[{"Config": "config.json", "Layers": []}]`,
+					"config.json":   `{"rootfs": {"type": "layers", "diff_ids": []}}`,
+				} {
+					Expect(tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(content))})).To(Succeed())
+					_, err := tw.Write([]byte(content))
+					Expect(err).NotTo(HaveOccurred())
+				}
+				Expect(tw.Close()).To(Succeed())
+
+				return ioutil.NopCloser(buffer), nil
+			}
+			runtime.Image.ID = "sha256:" + app.ImageName
+		})
+
+		it("matches layers by buildpack and name", func() {
+			Expect(app).To(matchers.ContainLayer("paketo-buildpacks/node-engine", "node"))
+			Expect(app).NotTo(matchers.ContainLayer("paketo-buildpacks/node-engine", "npm"))
+			Expect(app).NotTo(matchers.ContainLayer("paketo-buildpacks/npm-install", "node"))
+		})
+
+		it("lists the layers found in failure messages", func() {
+			matcher := matchers.ContainLayer("paketo-buildpacks/npm-install", "modules")
+			Expect(matcher.Match(&app)).To(BeFalse())
+			Expect(matcher.FailureMessage(&app)).To(Equal("Expected image some-image to contain layer paketo-buildpacks/npm-install:modules, found:\n" +
+				"    paketo-buildpacks/node-engine:node\n\n" +
+				"Container logs:\nListening on port 8080\n\n\n" +
+				"Build logs:\nsome build output"))
+
+			matcher = matchers.ContainLayer("paketo-buildpacks/node-engine", "node")
+			Expect(matcher.Match(&app)).To(BeTrue())
+			Expect(matcher.NegatedFailureMessage(&app)).To(HavePrefix("Expected image some-image not to contain layer paketo-buildpacks/node-engine:node\n"))
+		})
+	})
+
+	when("the app has been started", func() {
+		var (
+			server  *httptest.Server
+			healthy bool
+		)
+
+		it.Before(func() {
+			server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				switch req.URL.Path {
+				case "/":
+					w.Write([]byte("Hello, world!"))
+				case "/health":
+					w.Write([]byte(`{"status": "UP"}`))
+				default:
+					w.WriteHeader(http.StatusNotFound)
+					w.Write([]byte("not found"))
+				}
+			}))
+
+			serverURL, err := url.Parse(server.URL)
+			Expect(err).NotTo(HaveOccurred())
+
+			runtime.ContainerID = "some-container"
+			runtime.State = dagger.ContainerState{Status: "running", Running: true}
+			runtime.PortMappings = []dagger.PortMapping{{ContainerPort: "8080/tcp", HostIP: "127.0.0.1", HostPort: serverURL.Port()}}
+
+			healthy = true
+			Expect(app.StartWithContext(context.Background(), dagger.StartOptions{
+				Readiness: dagger.ReadinessFunc(func(context.Context, *dagger.App) (bool, error) {
+					return healthy, nil
+				}),
+				PollInterval: time.Millisecond,
+			})).To(Succeed())
+		})
+
+		it.After(func() {
+			server.Close()
+		})
+
+		when("Serve", func() {
+			it("matches the body served on a path", func() {
+				Expect(app).To(matchers.Serve("Hello"))
+				Expect(app).To(matchers.Serve(MatchJSON(`{"status": "UP"}`)).OnPath("/health"))
+				Expect(app).NotTo(matchers.Serve("Goodbye"))
+			})
+
+			it("fails on non-2xx responses with the status and body", func() {
+				matcher := matchers.Serve("anything").OnPath("/missing")
+				Expect(matcher.Match(&app)).To(BeFalse())
+
+				message := matcher.FailureMessage(&app)
+				Expect(message).To(HavePrefix("Expected /missing to respond with a 2xx status, got 404 with body:\n    not found"))
+				Expect(message).To(ContainSubstring("Container logs:\nListening on port 8080"))
+			})
+
+			it("includes the body matcher failure in failure messages", func() {
+				matcher := matchers.Serve("Goodbye")
+				Expect(matcher.Match(&app)).To(BeFalse())
+				Expect(matcher.FailureMessage(&app)).To(HavePrefix("Response body of /:\nExpected\n    <string>: Hello, world!\nto contain substring\n    <string>: Goodbye"))
+
+				matcher = matchers.Serve("Hello")
+				Expect(matcher.Match(&app)).To(BeTrue())
+				Expect(matcher.NegatedFailureMessage(&app)).To(HavePrefix("Response body of /:\nExpected\n    <string>: Hello, world!\nnot to contain substring"))
+			})
+		})
+
+		when("BeHealthy", func() {
+			it("matches a running app that passes its readiness check", func() {
+				Expect(app).To(matchers.BeHealthy())
+
+				healthy = false
+				Expect(app).NotTo(matchers.BeHealthy())
+
+				healthy = true
+				runtime.State = dagger.ContainerState{Status: "exited"}
+				Expect(app).NotTo(matchers.BeHealthy())
+			})
+
+			it("names the container in failure messages", func() {
+				healthy = false
+				matcher := matchers.BeHealthy()
+				Expect(matcher.Match(&app)).To(BeFalse())
+				Expect(matcher.FailureMessage(&app)).To(HavePrefix("Expected container some-container to be healthy\n"))
+				Expect(matcher.NegatedFailureMessage(&app)).To(HavePrefix("Expected container some-container not to be healthy\n"))
+			})
+		})
+	})
+
+	when("BeHealthy is given an app that was not started", func() {
+		it("returns an error", func() {
+			_, err := matchers.BeHealthy().Match(&app)
+			Expect(err).To(MatchError("app some-fixture has not been started"))
+		})
+	})
+
+	when("the actual value is not an app", func() {
+		it("returns an error", func() {
+			_, err := matchers.HaveFile("/some/file").Match(42)
+			Expect(err).To(MatchError("expected a dagger.App, got int"))
+		})
+
+		it("returns an error for a nil app", func() {
+			var nilApp *dagger.App
+			_, err := matchers.HaveLogged("anything").Match(nilApp)
+			Expect(err).To(MatchError("HaveLogged expects a dagger.App or a string, got nil"))
+
+			for _, matcher := range []types.GomegaMatcher{
+				matchers.HaveFile("/some/file"),
+				matchers.HaveBuildpackInGroup("some-buildpack", ""),
+				matchers.ContainLayer("some-buildpack", "some-layer"),
+				matchers.BeHealthy(),
+				matchers.Serve("anything"),
+			} {
+				_, err = matcher.Match(nilApp)
+				Expect(err).To(MatchError("expected a dagger.App, got nil"))
+			}
+		})
+	})
+}
@@ -0,0 +1,72 @@
+package matchers
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/cloudfoundry/dagger"
+	"github.com/onsi/gomega"
+	"github.com/onsi/gomega/format"
+	"github.com/onsi/gomega/types"
+)
+
+// ServeMatcher succeeds when a started app responds to a GET request with a
+// 2xx status and a matching body.
+type ServeMatcher struct {
+	expected types.GomegaMatcher
+	path     string
+	response dagger.Response
+	app      *dagger.App
+}
+
+// Serve matches the body an app serves. A string expectation matches when
+// the body contains it; any gomega matcher can be used instead.
+func Serve(body interface{}) *ServeMatcher {
+	expected, ok := body.(types.GomegaMatcher)
+	if !ok {
+		expected = gomega.ContainSubstring(fmt.Sprint(body))
+	}
+
+	return &ServeMatcher{
+		expected: expected,
+		path:     "/",
+	}
+}
+
+// OnPath sets the path requested from the app, "/" by default.
+func (m *ServeMatcher) OnPath(path string) *ServeMatcher {
+	m.path = path
+	return m
+}
+
+func (m *ServeMatcher) Match(actual interface{}) (bool, error) {
+	app, err := toApp(actual)
+	if err != nil {
+		return false, err
+	}
+	m.app = app
+
+	m.response, err = app.Request(http.MethodGet, m.path).Do()
+	if err != nil {
+		return false, err
+	}
+
+	if m.response.StatusCode < 200 || m.response.StatusCode > 299 {
+		return false, nil
+	}
+
+	return m.expected.Match(m.response.Body)
+}
+
+func (m *ServeMatcher) FailureMessage(actual interface{}) string {
+	if m.response.StatusCode < 200 || m.response.StatusCode > 299 {
+		return fmt.Sprintf("Expected %s to respond with a 2xx status, got %d with body:\n%s%s",
+			m.path, m.response.StatusCode, format.IndentString(m.response.Body, 1), appLogs(m.app))
+	}
+
+	return fmt.Sprintf("Response body of %s:\n%s%s", m.path, m.expected.FailureMessage(m.response.Body), appLogs(m.app))
+}
+
+func (m *ServeMatcher) NegatedFailureMessage(actual interface{}) string {
+	return fmt.Sprintf("Response body of %s:\n%s%s", m.path, m.expected.NegatedFailureMessage(m.response.Body), appLogs(m.app))
+}
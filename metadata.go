@@ -0,0 +1,188 @@
+package dagger
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+const (
+	LifecycleMetadataLabel = "io.buildpacks.lifecycle.metadata"
+	BuildMetadataLabel     = "io.buildpacks.build.metadata"
+	ProjectMetadataLabel   = "io.buildpacks.project.metadata"
+	StackIDLabel           = "io.buildpacks.stack.id"
+)
+
+// ImageMetadata is what the CNB lifecycle recorded in the labels of an app
+// image.
+type ImageMetadata struct {
+	StackID   string
+	Lifecycle LifecycleMetadata
+	Build     BuildMetadata
+	Project   ProjectMetadata
+}
+
+// LifecycleMetadata is the io.buildpacks.lifecycle.metadata label.
+type LifecycleMetadata struct {
+	Config     LayerSHA                  `json:"config"`
+	Launcher   LayerSHA                  `json:"launcher"`
+	Buildpacks []BuildpackLayersMetadata `json:"buildpacks"`
+	RunImage   RunImageMetadata          `json:"runImage"`
+	Stack      StackMetadata             `json:"stack"`
+}
+
+type LayerSHA struct {
+	SHA string `json:"sha"`
+}
+
+// BuildpackLayersMetadata holds the layers a buildpack contributed, keyed by
+// layer name.
+type BuildpackLayersMetadata struct {
+	ID      string                   `json:"key"`
+	Version string                   `json:"version"`
+	Layers  map[string]LayerMetadata `json:"layers"`
+}
+
+// LayerMetadata holds the flags and metadata of a layer, as written to its
+// <layer>.toml by the buildpack. SHA is the diff ID of the image layer.
+type LayerMetadata struct {
+	SHA    string                 `json:"sha"`
+	Data   map[string]interface{} `json:"data"`
+	Build  bool                   `json:"build"`
+	Launch bool                   `json:"launch"`
+	Cache  bool                   `json:"cache"`
+}
+
+type RunImageMetadata struct {
+	TopLayer  string `json:"topLayer"`
+	Reference string `json:"reference"`
+}
+
+type StackMetadata struct {
+	RunImage struct {
+		Image   string   `json:"image"`
+		Mirrors []string `json:"mirrors"`
+	} `json:"runImage"`
+}
+
+// BuildMetadata is the io.buildpacks.build.metadata label.
+type BuildMetadata struct {
+	BOM        []BOMEntry       `json:"bom"`
+	Buildpacks []BuildpackInfo  `json:"buildpacks"`
+	Launcher   LauncherMetadata `json:"launcher"`
+	Processes  []Process        `json:"processes"`
+}
+
+type BOMEntry struct {
+	Name      string                 `json:"name"`
+	Version   string                 `json:"version"`
+	Metadata  map[string]interface{} `json:"metadata"`
+	Buildpack BuildpackInfo          `json:"buildpack"`
+}
+
+type BuildpackInfo struct {
+	ID       string `json:"id"`
+	Version  string `json:"version"`
+	Homepage string `json:"homepage"`
+}
+
+type LauncherMetadata struct {
+	Version string `json:"version"`
+	Source  struct {
+		Git struct {
+			Repository string `json:"repository"`
+			Commit     string `json:"commit"`
+		} `json:"git"`
+	} `json:"source"`
+}
+
+type Process struct {
+	Type        string   `json:"type"`
+	Command     []string `json:"command"`
+	Args        []string `json:"args"`
+	Direct      bool     `json:"direct"`
+	Default     bool     `json:"default"`
+	BuildpackID string   `json:"buildpackID"`
+}
+
+// ProjectMetadata is the io.buildpacks.project.metadata label.
+type ProjectMetadata struct {
+	Source struct {
+		Type     string                 `json:"type"`
+		Version  map[string]interface{} `json:"version"`
+		Metadata map[string]interface{} `json:"metadata"`
+	} `json:"source"`
+}
+
+// UnmarshalJSON accepts the command both as a string, as written by older
+// platform APIs, and as a list.
+func (p *Process) UnmarshalJSON(data []byte) error {
+	type process Process
+	var raw struct {
+		process
+		Command json.RawMessage `json:"command"`
+	}
+
+	err := json.Unmarshal(data, &raw)
+	if err != nil {
+		return err
+	}
+
+	*p = Process(raw.process)
+	if len(raw.Command) == 0 {
+		return nil
+	}
+
+	var command string
+	if json.Unmarshal(raw.Command, &command) == nil {
+		p.Command = []string{command}
+		return nil
+	}
+
+	return json.Unmarshal(raw.Command, &p.Command)
+}
+
+// Metadata decodes the CNB lifecycle labels of the app image.
+func (a *App) Metadata() (ImageMetadata, error) {
+	runtime, err := a.containerRuntime()
+	if err != nil {
+		return ImageMetadata{}, err
+	}
+
+	image, err := runtime.InspectImage(context.Background(), a.ImageName)
+	if err != nil {
+		return ImageMetadata{}, err
+	}
+
+	return parseImageMetadata(a.ImageName, image.Config.Labels)
+}
+
+func parseImageMetadata(imageName string, labels map[string]string) (ImageMetadata, error) {
+	if _, ok := labels[LifecycleMetadataLabel]; !ok {
+		return ImageMetadata{}, fmt.Errorf("image %s has no %s label, it may not have been built by the lifecycle", imageName, LifecycleMetadataLabel)
+	}
+
+	metadata := ImageMetadata{
+		StackID: labels[StackIDLabel],
+	}
+
+	targets := map[string]interface{}{
+		LifecycleMetadataLabel: &metadata.Lifecycle,
+		BuildMetadataLabel:     &metadata.Build,
+		ProjectMetadataLabel:   &metadata.Project,
+	}
+
+	for label, target := range targets {
+		value, ok := labels[label]
+		if !ok || value == "" {
+			continue
+		}
+
+		err := json.Unmarshal([]byte(value), target)
+		if err != nil {
+			return ImageMetadata{}, fmt.Errorf("failed to parse %s label of image %s: %w", label, imageName, err)
+		}
+	}
+
+	return metadata, nil
+}
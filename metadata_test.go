@@ -0,0 +1,80 @@
+package dagger_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/cloudfoundry/dagger"
+	fakes "github.com/cloudfoundry/dagger/fakes/runtime"
+	"github.com/sclevine/spec"
+
+	. "github.com/onsi/gomega"
+)
+
+func testMetadata(t *testing.T, when spec.G, it spec.S) {
+	var (
+		app     dagger.App
+		runtime *fakes.ContainerRuntime
+	)
+
+	it.Before(func() {
+		runtime = &fakes.ContainerRuntime{}
+		runtime.Image.Config.Labels = map[string]string{
+			dagger.StackIDLabel: "io.buildpacks.stacks.bionic",
+			dagger.LifecycleMetadataLabel: `{
+				"buildpacks": [{
+					"key": "paketo-buildpacks/node-engine",
+					"version": "1.2.3",
+					"layers": {"node": {"sha": "sha256:abc", "data": {"version": "18.0.0"}, "launch": true, "build": false, "cache": true}}
+				}],
+				"runImage": {"topLayer": "sha256:top", "reference": "run@sha256:ref"},
+				"stack": {"runImage": {"image": "paketobuildpacks/run:base-cnb", "mirrors": ["mirror"]}}
+			}`,
+			dagger.BuildMetadataLabel: `{
+				"bom": [{"name": "node", "metadata": {"version": "18.0.0"}, "buildpack": {"id": "paketo-buildpacks/node-engine", "version": "1.2.3"}}],
+				"buildpacks": [{"id": "paketo-buildpacks/node-engine", "version": "1.2.3"}],
+				"launcher": {"version": "0.9.0"},
+				"processes": [
+					{"type": "web", "command": "node server.js", "direct": false, "buildpackID": "paketo-buildpacks/node-start"},
+					{"type": "worker", "command": ["node", "worker.js"], "args": ["--fast"], "direct": true}
+				]
+			}`,
+		}
+
+		app = dagger.NewApp("some-fixture", "some-image", "some-cache", bytes.NewBuffer(nil), map[string]string{})
+		app.SetContainerRuntime(runtime)
+	})
+
+	it("decodes the lifecycle labels", func() {
+		metadata, err := app.Metadata()
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(metadata.StackID).To(Equal("io.buildpacks.stacks.bionic"))
+
+		Expect(metadata.Lifecycle.Buildpacks).To(HaveLen(1))
+		Expect(metadata.Lifecycle.Buildpacks[0].ID).To(Equal("paketo-buildpacks/node-engine"))
+		Expect(metadata.Lifecycle.Buildpacks[0].Layers["node"]).To(Equal(dagger.LayerMetadata{
+			SHA:    "sha256:abc",
+			Data:   map[string]interface{}{"version": "18.0.0"},
+			Launch: true,
+			Cache:  true,
+		}))
+		Expect(metadata.Lifecycle.RunImage.Reference).To(Equal("run@sha256:ref"))
+		Expect(metadata.Lifecycle.Stack.RunImage.Image).To(Equal("paketobuildpacks/run:base-cnb"))
+
+		Expect(metadata.Build.BOM[0].Name).To(Equal("node"))
+		Expect(metadata.Build.BOM[0].Buildpack.ID).To(Equal("paketo-buildpacks/node-engine"))
+		Expect(metadata.Build.Launcher.Version).To(Equal("0.9.0"))
+		Expect(metadata.Build.Processes).To(Equal([]dagger.Process{
+			{Type: "web", Command: []string{"node server.js"}, BuildpackID: "paketo-buildpacks/node-start"},
+			{Type: "worker", Command: []string{"node", "worker.js"}, Args: []string{"--fast"}, Direct: true},
+		}))
+	})
+
+	it("fails for images not built by the lifecycle", func() {
+		runtime.Image.Config.Labels = map[string]string{}
+
+		_, err := app.Metadata()
+		Expect(err).To(MatchError(ContainSubstring("image some-image has no io.buildpacks.lifecycle.metadata label")))
+	})
+}
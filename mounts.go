@@ -0,0 +1,79 @@
+package dagger
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+
+	"github.com/cloudfoundry/dagger/utils"
+)
+
+const (
+	MountTypeBind   = "bind"
+	MountTypeVolume = "volume"
+	MountTypeTmpfs  = "tmpfs"
+)
+
+// Mount is a filesystem mounted into the app container.
+type Mount struct {
+	// Type is one of MountTypeBind, MountTypeVolume or MountTypeTmpfs.
+	Type string `json:"Type"`
+
+	// Source is the host path of a bind mount, or the name of a volume. A
+	// volume without a name gets a generated one.
+	Source string `json:"Source,omitempty"`
+
+	// Target is the absolute path of the mount in the container.
+	Target string `json:"Target"`
+
+	ReadOnly bool `json:"ReadOnly,omitempty"`
+}
+
+// resolveMounts validates mounts, makes bind sources absolute and names
+// anonymous volumes. Targets must not repeat, nor be mounted by the tmpfs
+// run option.
+func resolveMounts(mounts []Mount, tmpfs map[string]string) ([]Mount, error) {
+	targets := map[string]bool{}
+	for target := range tmpfs {
+		targets[path.Clean(target)] = true
+	}
+
+	var resolved []Mount
+	for _, mount := range mounts {
+		if !path.IsAbs(mount.Target) {
+			return nil, fmt.Errorf("invalid mount target %q: must be an absolute path", mount.Target)
+		}
+
+		if targets[path.Clean(mount.Target)] {
+			return nil, fmt.Errorf("%s mount at %s conflicts with another mount at the same target", mount.Type, mount.Target)
+		}
+		targets[path.Clean(mount.Target)] = true
+
+		switch mount.Type {
+		case MountTypeBind:
+			if mount.Source == "" {
+				return nil, fmt.Errorf("bind mount at %s requires a source", mount.Target)
+			}
+
+			source, err := filepath.Abs(mount.Source)
+			if err != nil {
+				return nil, err
+			}
+			mount.Source = source
+		case MountTypeVolume:
+			if mount.Source == "" {
+				mount.Source = fmt.Sprintf("dagger-%s", utils.RandStringRunes(12))
+			}
+		case MountTypeTmpfs:
+			if mount.Source != "" {
+				return nil, fmt.Errorf("tmpfs mount at %s cannot have a source", mount.Target)
+			}
+		default:
+			return nil, fmt.Errorf("unsupported mount type %q: please use either 'bind', 'volume' or 'tmpfs'", mount.Type)
+		}
+
+		resolved = append(resolved, mount)
+	}
+
+	return resolved, nil
+}
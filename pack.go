@@ -3,6 +3,7 @@ package dagger
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"crypto/sha256"
 	"fmt"
 	"io"
@@ -10,8 +11,8 @@ import (
 	"sort"
 	"strings"
 	"sync"
+	"time"
 
-	"github.com/buildpack/libbuildpack/logger"
 	"github.com/cloudfoundry/dagger/utils"
 	"github.com/paketo-buildpacks/packit/pexec"
 )
@@ -25,11 +26,11 @@ const (
 	TestBuilderImage  = "cloudfoundry/cnb:cflinuxfs3"
 	Cflinuxfs3Builder = "cloudfoundry/cnb:cflinuxfs3"
 	BionicBuilder     = "cloudfoundry/cnb:bionic"
-	logBufferSize     = 1024
 )
 
 var (
-	logQueue                chan chan []byte
+	logQueue                chan *queuedLog
+	printLoopDone           chan struct{}
 	stdoutMutex             sync.Mutex
 	queueIsInitialized      bool
 	queueIsInitializedMutex sync.Mutex
@@ -49,10 +50,15 @@ type Pack struct {
 	env        map[string]string
 	buildpacks []string
 	offline    bool
-	executable Executable
+	executable contextExecutable
 	verbose    bool
 	builder    string
 	noPull     bool
+	runtime    ContainerRuntime
+	bindings   []Binding
+	registry   *LocalRegistry
+	timeout    time.Duration
+	output     io.Writer
 }
 
 type PackOption func(Pack) Pack
@@ -149,27 +155,37 @@ func NoPull() PackOption {
 	}
 }
 
-func NewPack(dir string, options ...PackOption) Pack {
-	var w io.Writer
-	queueIsInitializedMutex.Lock()
-	if queueIsInitialized {
-		log := make(chan []byte, logBufferSize)
-		logQueue <- log
-		cw := newChanWriter(log)
-		w = cw
-		defer cw.Close()
-	} else {
-		w = os.Stdout
+// SetOutput streams the output of pack build to output while it runs. Within
+// SyncParallelOutput, output defaults to stdout and receives the output of
+// each build in one piece, after the builds started before it.
+func SetOutput(output io.Writer) PackOption {
+	return func(pack Pack) Pack {
+		pack.output = output
+		return pack
 	}
-	queueIsInitializedMutex.Unlock()
+}
 
-	buildLogs := &bytes.Buffer{}
+// SetBuildTimeout bounds how long Build waits for pack to finish.
+func SetBuildTimeout(timeout time.Duration) PackOption {
+	return func(pack Pack) Pack {
+		pack.timeout = timeout
+		return pack
+	}
+}
 
-	logger.NewLogger(io.MultiWriter(w, buildLogs), io.MultiWriter(w, buildLogs))
+// SetContainerRuntime sets the runtime the built App uses to run containers,
+// which also pulls the builder for SetOffline.
+func SetContainerRuntime(runtime ContainerRuntime) PackOption {
+	return func(pack Pack) Pack {
+		pack.runtime = runtime
+		return pack
+	}
+}
 
+func NewPack(dir string, options ...PackOption) Pack {
 	pack := Pack{
 		dir:        dir,
-		executable: pexec.NewExecutable("pack"),
+		executable: newGroupExecutable("pack"),
 	}
 
 	for _, option := range options {
@@ -180,12 +196,50 @@ func NewPack(dir string, options ...PackOption) Pack {
 }
 
 func (p Pack) Build() (*App, error) {
+	return p.BuildContext(context.Background())
+}
+
+// BuildContext runs pack build. If the context is done or the build timeout
+// expires first, the pack process and every process it started are killed,
+// the lifecycle containers of the build are removed, and a *BuildError
+// carrying the logs so far is returned.
+func (p Pack) BuildContext(ctx context.Context) (*App, error) {
+	if p.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, p.timeout)
+		defer cancel()
+	}
+
 	builderImage, err := getBuilderImage(p.builder)
 	if err != nil {
 		return nil, err
 	}
 
-	packArgs := []string{"build", p.image, "--builder", builderImage}
+	version, err := installedPackVersion(p.executable)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(p.bindings) > 0 {
+		err = version.require("SetBinding", packVolumeVersion)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if p.offline {
+		err = version.require("SetOffline", packNetworkVersion)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	image := p.image
+	if p.registry != nil {
+		image = p.registry.Reference(p.image)
+	}
+
+	packArgs := []string{"build", image, "--builder", builderImage}
 	for _, bp := range p.buildpacks {
 		packArgs = append(packArgs, "--buildpack", bp)
 	}
@@ -201,22 +255,40 @@ func (p Pack) Build() (*App, error) {
 		packArgs = append(packArgs, "-e", fmt.Sprintf("%s=%s", key, p.env[key]))
 	}
 
+	if len(p.bindings) > 0 {
+		bindingsDir, err := writeBindings(p.bindings)
+		if err != nil {
+			return nil, err
+		}
+		defer os.RemoveAll(bindingsDir)
+
+		packArgs = append(packArgs,
+			"--volume", fmt.Sprintf("%s:%s", bindingsDir, BindingRoot),
+			"-e", fmt.Sprintf("SERVICE_BINDING_ROOT=%s", BindingRoot),
+		)
+	}
+
+	if p.registry != nil {
+		packArgs = append(packArgs, "--publish")
+	}
+
 	if p.noPull {
-		packArgs = append(packArgs, "--no-pull")
+		if version.atLeast(packPullPolicyVersion) {
+			packArgs = append(packArgs, "--pull-policy", "never")
+		} else {
+			packArgs = append(packArgs, "--no-pull")
+		}
 	}
 
 	if p.offline {
-		dockerExec := pexec.NewExecutable("docker")
-
-		stdout := bytes.NewBuffer(nil)
-		stderr := bytes.NewBuffer(nil)
-		err := dockerExec.Execute(pexec.Execution{
-			Args:   []string{"pull", builderImage},
-			Stdout: stdout,
-			Stderr: stderr,
-		})
+		runtime, err := p.containerRuntime()
+		if err != nil {
+			return nil, err
+		}
+
+		err = runtime.PullImage(ctx, builderImage)
 		if err != nil {
-			return nil, fmt.Errorf("failed to pull %s\n with stdout %s\n stderr %s\n%s", builderImage, stdout, stderr, err.Error())
+			return nil, err
 		}
 		packArgs = append(packArgs, "--network", "none")
 	}
@@ -225,28 +297,116 @@ func (p Pack) Build() (*App, error) {
 		packArgs = append(packArgs, "-v")
 	}
 
+	reference := fmt.Sprintf("index.docker.io/library/%s:latest", image)
+	if p.registry != nil {
+		reference = fmt.Sprintf("%s:latest", image)
+	}
+
+	// Builds that can be stopped record their containers to remove them
+	var build *buildContainers
+	if ctx.Done() != nil {
+		runtime, err := p.containerRuntime()
+		if err != nil {
+			return nil, err
+		}
+
+		build, err = newBuildContainers(runtime, builderImage, []string{image, reference}, version.atLeast(packVolumeVersion))
+		if err != nil {
+			return nil, err
+		}
+		defer build.close()
+
+		packArgs = append(packArgs, build.volumeArgs()...)
+	}
+
 	buildLogs := bytes.NewBuffer(nil)
-	err = p.executable.Execute(pexec.Execution{
-		Args:   packArgs,
-		Stdout: buildLogs,
-		Stderr: buildLogs,
+	var output io.Writer = buildLogs
+	if live := p.liveOutput(); live != nil {
+		defer live.Close()
+		output = io.MultiWriter(buildLogs, live)
+	}
+
+	err = p.run(ctx, packArgs, output, build)
+	if err != nil {
+		return nil, &BuildError{Logs: buildLogs.String(), Err: err}
+	}
+
+	sum := sha256.Sum256([]byte(reference)) //This is how pack makes cache image names
+	cacheImage := fmt.Sprintf("pack-cache-%x", sum[:6])
+
+	app := NewApp(p.dir, image, cacheImage, buildLogs, make(map[string]string))
+	app.runtime = p.runtime
+	app.pack = &p
+	return &app, nil
+}
+
+// run runs pack in its own process group. When ctx is done, pack and every
+// process it started are killed and the containers recorded by build are
+// removed.
+func (p Pack) run(ctx context.Context, args []string, output io.Writer, build *buildContainers) error {
+	if build != nil {
+		done := make(chan struct{})
+		defer close(done)
+		go build.watch(ctx, done)
+	}
+
+	err := p.executable.ExecuteContext(ctx, pexec.Execution{
+		Args:   args,
 		Dir:    p.dir,
+		Stdout: output,
+		Stderr: output,
 	})
+	if err == nil || ctx.Err() == nil {
+		return err
+	}
 
+	// Whether pack was killed or failed on its own, the build did not finish
+	err = build.remove()
 	if err != nil {
-		output := &strings.Builder{}
-		printErr := printBufferSafely(buildLogs, output)
-		if printErr != nil {
-			return nil, printErr
+		return fmt.Errorf("pack build did not finish: %s: %w", ctx.Err(), err)
+	}
+
+	return fmt.Errorf("pack build did not finish: %w", ctx.Err())
+}
+
+// containerRuntime returns the runtime set with SetContainerRuntime, or else
+// the one selected by the environment.
+func (p Pack) containerRuntime() (ContainerRuntime, error) {
+	if p.runtime != nil {
+		return p.runtime, nil
+	}
+
+	return NewContainerRuntime("")
+}
+
+// commandNames reports whether one of the arguments of command is one of
+// images.
+func commandNames(command string, images []string) bool {
+	for _, argument := range strings.Fields(command) {
+		for _, image := range images {
+			if argument == image {
+				return true
+			}
 		}
-		return nil, fmt.Errorf("failed to pack build with output:\n%s\n--> error message: %w", output, err)
 	}
 
-	sum := sha256.Sum256([]byte(fmt.Sprintf("index.docker.io/library/%s:latest", p.image))) //This is how pack makes cache image names
-	cacheImage := fmt.Sprintf("pack-cache-%x", sum[:6])
+	return false
+}
 
-	app := NewApp(p.dir, p.image, cacheImage, buildLogs, make(map[string]string))
-	return &app, nil
+// BuildError is returned when pack build fails or does not finish in time.
+type BuildError struct {
+	Logs string
+	Err  error
+}
+
+func (e *BuildError) Error() string {
+	output := &strings.Builder{}
+	_ = printBufferSafely(strings.NewReader(e.Logs), output)
+	return fmt.Sprintf("failed to pack build with output:\n%s\n--> error message: %s", output, e.Err)
+}
+
+func (e *BuildError) Unwrap() error {
+	return e.Err
 }
 
 func printBufferSafely(src io.Reader, dst io.Writer) error {
@@ -263,21 +423,80 @@ func printBufferSafely(src io.Reader, dst io.Writer) error {
 	return nil
 }
 
-type chanWriter struct {
-	channel chan []byte
+// liveOutput returns where build output is streamed while pack runs, if
+// anywhere. Within SyncParallelOutput, it is queued behind the output of the
+// builds started before.
+func (p Pack) liveOutput() io.WriteCloser {
+	queueIsInitializedMutex.Lock()
+	defer queueIsInitializedMutex.Unlock()
+
+	if queueIsInitialized {
+		writer := p.output
+		if writer == nil {
+			writer = os.Stdout
+		}
+
+		log := newQueuedLog(writer)
+		logQueue <- log
+		return log
+	}
+
+	if p.output != nil {
+		return nopWriteCloser{p.output}
+	}
+
+	return nil
 }
 
-func newChanWriter(c chan []byte) *chanWriter {
-	return &chanWriter{c}
+type nopWriteCloser struct {
+	io.Writer
 }
 
-func (c *chanWriter) Write(p []byte) (n int, err error) {
-	c.channel <- append([]byte{}, p...) // Create a copy to avoid mutation of backing slice
+func (nopWriteCloser) Close() error {
+	return nil
+}
+
+// queuedLog is the output of one build, printed to writer once the builds
+// queued before it are done. Until then it is buffered in full, so that the
+// build never waits for the builds ahead of it.
+type queuedLog struct {
+	writer io.Writer
+	ready  chan struct{}
+	mutex  sync.Mutex
+	buffer bytes.Buffer
+	closed bool
+}
+
+func newQueuedLog(writer io.Writer) *queuedLog {
+	return &queuedLog{
+		writer: writer,
+		ready:  make(chan struct{}, 1),
+	}
+}
+
+func (l *queuedLog) Write(p []byte) (n int, err error) {
+	l.mutex.Lock()
+	l.buffer.Write(p)
+	l.mutex.Unlock()
+
+	l.notify()
 	return len(p), nil
 }
 
-func (c *chanWriter) Close() {
-	close(c.channel)
+func (l *queuedLog) Close() error {
+	l.mutex.Lock()
+	l.closed = true
+	l.mutex.Unlock()
+
+	l.notify()
+	return nil
+}
+
+func (l *queuedLog) notify() {
+	select {
+	case l.ready <- struct{}{}:
+	default:
+	}
 }
 
 func SyncParallelOutput(f func()) {
@@ -288,41 +507,52 @@ func SyncParallelOutput(f func()) {
 
 func startOutputStream() {
 	fmt.Println("Starting to stream output...")
-	logQueue = make(chan chan []byte, 1024) // Arbitrary buffer size to reduce blocking
+	logQueue = make(chan *queuedLog, 1024) // Arbitrary buffer size to reduce blocking
+	printLoopDone = make(chan struct{})
 	queueIsInitializedMutex.Lock()
 	queueIsInitialized = true
 	queueIsInitializedMutex.Unlock()
 	go printLoop()
 }
 
+// stopOutputStream waits for the output of every queued build to be printed.
 func stopOutputStream() {
+	queueIsInitializedMutex.Lock()
+	queueIsInitialized = false
 	close(logQueue)
+	queueIsInitializedMutex.Unlock()
+
+	<-printLoopDone
 	fmt.Println("Stopped streaming output.")
 }
 
 func printLoop() {
+	defer close(printLoopDone)
 	for log := range logQueue {
 		printLog(log)
 	}
 }
 
-func printLog(log chan []byte) {
-	for line := range log {
-		stdoutMutex.Lock()
-		fmt.Print(string(line))
-		stdoutMutex.Unlock()
-	}
-}
+// printLog prints the output of a build as it is written, until the build is
+// done.
+func printLog(log *queuedLog) {
+	for {
+		log.mutex.Lock()
+		output := append([]byte{}, log.buffer.Bytes()...)
+		log.buffer.Reset()
+		closed := log.closed
+		log.mutex.Unlock()
+
+		if len(output) > 0 {
+			stdoutMutex.Lock()
+			log.writer.Write(output)
+			stdoutMutex.Unlock()
+		}
 
-func getBuilderImage(packBuilder string) (string, error) {
-	if packBuilder == "" {
-		return Cflinuxfs3Builder, nil
-	}
+		if closed {
+			return
+		}
 
-	val, found := builderMap[packBuilder]
-	if !found {
-		return "", fmt.Errorf("please use either 'bionic' or 'cflinuxfs3' as input keys to SetBuilder")
+		<-log.ready
 	}
-
-	return val, nil
 }
@@ -1,11 +1,22 @@
 package dagger_test
 
 import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
 	"os"
 	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/cloudfoundry/dagger"
+	fakes "github.com/cloudfoundry/dagger/fakes/runtime"
+	"github.com/onsi/gomega/gexec"
 	"github.com/sclevine/spec"
 
 	. "github.com/onsi/gomega"
@@ -54,13 +65,16 @@ func testPack(t *testing.T, when spec.G, it spec.S) {
 		})
 
 		it("should pack in offline containers", func() {
+			runtime := &fakes.ContainerRuntime{}
 			packer := dagger.NewPack(tmpDir,
 				dagger.SetBuildpacks("first-bp"),
 				dagger.SetImage("test-pack-image"),
 				dagger.SetOffline(),
+				dagger.SetContainerRuntime(runtime),
 			)
 			app, err := packer.Build()
 			Expect(err).NotTo(HaveOccurred())
+			Expect(runtime.Pulled).To(Equal([]string{"cloudfoundry/cnb:cflinuxfs3"}))
 
 			Expect(app.BuildLogs()).To(ContainSubstring("pack build test-pack-image --builder cloudfoundry/cnb:cflinuxfs3 --buildpack first-bp --no-pull --network none]"))
 		})
@@ -78,16 +92,76 @@ func testPack(t *testing.T, when spec.G, it spec.S) {
 			Expect(app.BuildLogs()).To(ContainSubstring("pack build test-pack-image --builder cloudfoundry/cnb:cflinuxfs3 -e env1=val1 -e env2=val2]"))
 		})
 
-		it("should not pack with given builder that is not supported", func() {
+		it("should pack with an arbitrary builder image", func() {
+			packer := dagger.NewPack(tmpDir,
+				dagger.SetBuilder("paketobuildpacks/builder:base"),
+			)
+			app, err := packer.Build()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(app.BuildLogs()).To(ContainSubstring("pack build  --builder paketobuildpacks/builder:base]"))
+		})
+
+		it("should not pack with a builder that is neither an alias nor an image reference", func() {
 			packer := dagger.NewPack(tmpDir,
 				dagger.SetBuildpacks("first-bp", "second-bp"),
-				dagger.SetBuilder("not-supported"),
+				dagger.SetBuilder("Not Supported"),
 			)
 			app, err := packer.Build()
-			Expect(err.Error()).To(ContainSubstring("please use either 'bionic' or 'cflinuxfs3' as input keys to SetBuilder"))
+			Expect(err).To(MatchError(`invalid builder "Not Supported": please use a registered alias or an image reference`))
 			Expect(app).To(BeNil())
 		})
 
+		when("builders are configured", func() {
+			it.After(func() {
+				Expect(dagger.SetDefaultBuilder(dagger.Cflinuxfs3Builder)).To(Succeed())
+			})
+
+			it("should pack with registered aliases and the default builder", func() {
+				configPath := filepath.Join(tmpDir, "dagger-config.json")
+				Expect(ioutil.WriteFile(configPath, []byte(`{
+					"builder": "heroku",
+					"builders": {"heroku": "heroku/buildpacks:20", "paketo": "paketobuildpacks/builder:base"}
+				}`), 0644)).To(Succeed())
+				defer os.Remove(configPath)
+
+				config, err := dagger.ParseConfig(configPath)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(config.ConfigureBuilders()).To(Succeed())
+				Expect(dagger.DefaultBuilder()).To(Equal("heroku/buildpacks:20"))
+
+				app, err := dagger.NewPack(tmpDir).Build()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(app.BuildLogs()).To(ContainSubstring("pack build  --builder heroku/buildpacks:20]"))
+
+				Expect(dagger.RegisterBuilder("custom", "localhost:5000/custom-builder:latest")).To(Succeed())
+				app, err = dagger.NewPack(tmpDir, dagger.SetBuilder("custom")).Build()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(app.BuildLogs()).To(ContainSubstring("pack build  --builder localhost:5000/custom-builder:latest]"))
+			})
+
+			it("should not register invalid image references", func() {
+				Expect(dagger.RegisterBuilder("custom", "Not Valid")).To(MatchError(`invalid builder image reference "Not Valid"`))
+			})
+		})
+
+		it("should pack with bindings mounted at the binding root", func() {
+			packer := dagger.NewPack(tmpDir,
+				dagger.SetImage("test-pack-image"),
+				dagger.SetBinding("some-ca", "ca-certificates", map[string]string{"cert.pem": "some-cert"}),
+			)
+			app, err := packer.Build()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(app.BuildLogs()).To(MatchRegexp(`pack build test-pack-image --builder cloudfoundry/cnb:cflinuxfs3 --volume \S+:/platform/bindings -e SERVICE_BINDING_ROOT=/platform/bindings\]`))
+		})
+
+		it("should not pack with invalid bindings", func() {
+			packer := dagger.NewPack(tmpDir,
+				dagger.SetBinding("some-ca", "", nil),
+			)
+			_, err := packer.Build()
+			Expect(err).To(MatchError("binding requires a name and a type"))
+		})
+
 		it("should pack with a no-pull flag", func() {
 			packer := dagger.NewPack(tmpDir,
 				dagger.SetImage("test-pack-image"),
@@ -97,5 +171,357 @@ func testPack(t *testing.T, when spec.G, it spec.S) {
 			Expect(err).NotTo(HaveOccurred())
 			Expect(app.BuildLogs()).To(ContainSubstring("pack build test-pack-image --builder cloudfoundry/cnb:cflinuxfs3 --no-pull]"))
 		})
+
+		it("should stream output while still capturing build logs", func() {
+			output := bytes.NewBuffer(nil)
+			app, err := dagger.NewPack(tmpDir, dagger.SetOutput(output)).Build()
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(output.String()).To(ContainSubstring("pack build  --builder cloudfoundry/cnb:cflinuxfs3]"))
+			Expect(output.String()).To(Equal(app.BuildLogs()))
+		})
+
+		it("should print the output of parallel builds one build at a time", func() {
+			first, second := bytes.NewBuffer(nil), bytes.NewBuffer(nil)
+			var firstApp, secondApp *dagger.App
+
+			dagger.SyncParallelOutput(func() {
+				var wg sync.WaitGroup
+				wg.Add(2)
+				go func() {
+					defer wg.Done()
+					firstApp, _ = dagger.NewPack(tmpDir, dagger.SetImage("first-image"), dagger.SetOutput(first)).Build()
+				}()
+				go func() {
+					defer wg.Done()
+					secondApp, _ = dagger.NewPack(tmpDir, dagger.SetImage("second-image"), dagger.SetOutput(second)).Build()
+				}()
+				wg.Wait()
+			})
+
+			Expect(firstApp).NotTo(BeNil())
+			Expect(secondApp).NotTo(BeNil())
+			Expect(first.String()).To(Equal(firstApp.BuildLogs()))
+			Expect(second.String()).To(Equal(secondApp.BuildLogs()))
+		})
+	})
+
+	when("rebuilding an app", func() {
+		var appDir string
+
+		it.Before(func() {
+			var err error
+			appDir, err = ioutil.TempDir("", "rebuild")
+			Expect(err).NotTo(HaveOccurred())
+
+			appDir, err = filepath.EvalSymlinks(appDir)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		it.After(func() {
+			Expect(os.RemoveAll(appDir)).To(Succeed())
+		})
+
+		it("builds the same image again and reports layer reuse", func() {
+			app, err := dagger.NewPack(appDir,
+				dagger.SetImage("test-pack-image"),
+				dagger.SetBuildpacks("first-bp"),
+			).Build()
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(ioutil.WriteFile(filepath.Join(appDir, ".fake-pack-output"), []byte(strings.Join([]string{
+				`[restorer] Restoring data for "some-bp:cached" from cache`,
+				`[restorer] Restoring cached layer 'some-bp:old-style'`,
+				`[exporter] Reusing layer 'some-bp:cached'`,
+				`[exporter] Adding layer 'some-bp:changed'`,
+				`[exporter] Reusing cache layer 'some-bp:cached'`,
+				`[exporter] Adding layer 'launcher'`,
+				`[exporter] Reusing 1/1 app layer(s)`,
+			}, "\n")), 0644)).To(Succeed())
+
+			result, err := app.Rebuild(dagger.SetEnv(map[string]string{"SOME_VAR": "some-value"}))
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(result.Restored).To(Equal([]string{"some-bp:cached", "some-bp:old-style"}))
+			Expect(result.Reused).To(Equal([]string{"some-bp:cached"}))
+			Expect(result.Rebuilt).To(Equal([]string{"some-bp:changed"}))
+
+			Expect(app.BuildLogs()).To(ContainSubstring("pack build test-pack-image --builder cloudfoundry/cnb:cflinuxfs3 --buildpack first-bp -e SOME_VAR=some-value]"))
+			Expect(result.BuildLogs).To(Equal(app.BuildLogs()))
+		})
+
+		it("fails for apps that were not built with pack", func() {
+			app := dagger.NewApp(appDir, "some-image", "some-cache", nil, nil)
+			_, err := app.Rebuild()
+			Expect(err).To(MatchError("app was not built with pack and cannot be rebuilt"))
+		})
 	})
+
+	when("a build hangs", func() {
+		var (
+			appDir       string
+			output       *syncBuffer
+			runtime      *fakes.ContainerRuntime
+			builderImage string
+		)
+
+		it.Before(func() {
+			var err error
+			appDir, err = ioutil.TempDir("", "hang")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(ioutil.WriteFile(filepath.Join(appDir, ".fake-pack-hang"), nil, 0644)).To(Succeed())
+
+			output = &syncBuffer{}
+
+			// The detector of the build, which only mounts the marker passed
+			// to pack, is gone by the time its restorer hangs
+			var calls int
+			runtime = &fakes.ContainerRuntime{}
+			runtime.ContainersFromStub = func(ctx context.Context, image string, since time.Time) ([]dagger.ContainerSummary, error) {
+				builderImage = image
+				calls++
+
+				sibling := dagger.ContainerSummary{
+					ID:      "sibling-id",
+					Command: "/cnb/lifecycle/creator -daemon index.docker.io/library/sibling-image:latest",
+					Mounts:  []dagger.MountPoint{{Name: "pack-layers-sibling", Destination: "/layers"}},
+				}
+
+				if calls == 1 {
+					return []dagger.ContainerSummary{
+						{
+							ID:      "detector-id",
+							Command: "/cnb/lifecycle/detector -app /workspace",
+							Mounts: []dagger.MountPoint{
+								{Name: "pack-layers-build", Destination: "/layers"},
+								{Source: "/some/marker", Destination: markerTarget(output.String())},
+							},
+						},
+						sibling,
+					}, nil
+				}
+
+				return []dagger.ContainerSummary{
+					sibling,
+					{
+						ID:      "sibling-restorer-id",
+						Command: "/cnb/lifecycle/restorer -layers /layers",
+						Mounts:  []dagger.MountPoint{{Name: "pack-layers-sibling", Destination: "/layers"}},
+					},
+					{
+						ID:      "restorer-id",
+						Command: "/cnb/lifecycle/restorer -layers /layers",
+						Mounts:  []dagger.MountPoint{{Name: "pack-layers-build", Destination: "/layers"}},
+					},
+					{ID: "exporter-id", Command: "/cnb/lifecycle/exporter hanging-image"},
+					{ID: "creator-id", Command: "/cnb/lifecycle/creator -daemon -run-image some-run-image index.docker.io/library/hanging-image:latest"},
+				}, nil
+			}
+		})
+
+		it.After(func() {
+			Expect(os.RemoveAll(appDir)).To(Succeed())
+		})
+
+		it("should kill pack and the lifecycle containers of the build once it times out", func() {
+			started := time.Now()
+			_, err := dagger.NewPack(appDir,
+				dagger.SetImage("hanging-image"),
+				dagger.SetBuildTimeout(time.Second),
+				dagger.SetContainerRuntime(runtime),
+				dagger.SetOutput(output),
+			).Build()
+			Expect(time.Since(started)).To(BeNumerically("<", 10*time.Second))
+
+			Expect(errors.Is(err, context.DeadlineExceeded)).To(BeTrue())
+
+			var buildErr *dagger.BuildError
+			Expect(errors.As(err, &buildErr)).To(BeTrue())
+			Expect(buildErr.Logs).To(ContainSubstring("Pack output on stdout"))
+			Expect(buildErr.Logs).To(ContainSubstring("Hanging..."))
+
+			Expect(builderImage).To(Equal("cloudfoundry/cnb:cflinuxfs3"))
+			Expect(runtime.Removed).To(Equal([]string{"restorer-id", "exporter-id", "creator-id"}))
+
+			marker := regexp.MustCompile(`--volume (\S+):/dagger/`).FindStringSubmatch(buildErr.Logs)
+			Expect(marker).To(HaveLen(2))
+			Expect(marker[1]).NotTo(BeADirectory())
+		})
+
+		it("should stop the build when the context is cancelled", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			time.AfterFunc(200*time.Millisecond, cancel)
+
+			_, err := dagger.NewPack(appDir, dagger.SetContainerRuntime(runtime)).BuildContext(ctx)
+			Expect(errors.Is(err, context.Canceled)).To(BeTrue())
+			Expect(err).To(MatchError(ContainSubstring("pack build did not finish: context canceled")))
+		})
+	})
+
+	when("builds run in parallel", func() {
+		var (
+			hangingDir string
+			linesDir   string
+		)
+
+		it.Before(func() {
+			var err error
+			hangingDir, err = ioutil.TempDir("", "hang")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(ioutil.WriteFile(filepath.Join(hangingDir, ".fake-pack-lines"), []byte("2000"), 0644)).To(Succeed())
+			Expect(ioutil.WriteFile(filepath.Join(hangingDir, ".fake-pack-hang"), nil, 0644)).To(Succeed())
+
+			linesDir, err = ioutil.TempDir("", "lines")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(ioutil.WriteFile(filepath.Join(linesDir, ".fake-pack-lines"), []byte("2000"), 0644)).To(Succeed())
+		})
+
+		it.After(func() {
+			Expect(os.RemoveAll(hangingDir)).To(Succeed())
+			Expect(os.RemoveAll(linesDir)).To(Succeed())
+		})
+
+		// buildBehindHangingBuild runs a build from linesDir while the output of
+		// a hanging build, queued before it, is still being printed.
+		buildBehindHangingBuild := func(output io.Writer, options ...dagger.PackOption) (*dagger.App, error) {
+			var (
+				app *dagger.App
+				err error
+			)
+
+			dagger.SyncParallelOutput(func() {
+				ctx, cancel := context.WithCancel(context.Background())
+				hanging := &syncBuffer{}
+				hangingDone := make(chan struct{})
+				go func() {
+					defer close(hangingDone)
+					_, _ = dagger.NewPack(hangingDir,
+						dagger.SetOutput(hanging),
+						dagger.SetContainerRuntime(&fakes.ContainerRuntime{}),
+					).BuildContext(ctx)
+				}()
+				Eventually(hanging.String, 10*time.Second).Should(ContainSubstring("Hanging..."))
+
+				options = append(options, dagger.SetOutput(output), dagger.SetContainerRuntime(&fakes.ContainerRuntime{}))
+				app, err = dagger.NewPack(linesDir, options...).Build()
+
+				cancel()
+				<-hangingDone
+			})
+
+			return app, err
+		}
+
+		it("should not block a queued build on its output", func() {
+			output := &syncBuffer{}
+			started := time.Now()
+			app, err := buildBehindHangingBuild(output)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(time.Since(started)).To(BeNumerically("<", 30*time.Second))
+
+			Expect(app.BuildLogs()).To(ContainSubstring("Line 1999\n"))
+			Expect(output.String()).To(Equal(app.BuildLogs()))
+		})
+
+		it("should time out a queued build", func() {
+			Expect(ioutil.WriteFile(filepath.Join(linesDir, ".fake-pack-hang"), nil, 0644)).To(Succeed())
+
+			output := &syncBuffer{}
+			started := time.Now()
+			_, err := buildBehindHangingBuild(output, dagger.SetBuildTimeout(2*time.Second))
+			Expect(time.Since(started)).To(BeNumerically("<", 30*time.Second))
+			Expect(errors.Is(err, context.DeadlineExceeded)).To(BeTrue())
+
+			var buildErr *dagger.BuildError
+			Expect(errors.As(err, &buildErr)).To(BeTrue())
+			Expect(buildErr.Logs).To(ContainSubstring("Line 0\n"))
+			Expect(output.String()).To(Equal(buildErr.Logs))
+		})
+	})
+
+	when("running a newer pack", func() {
+		var existingPath string
+
+		it.Before(func() {
+			existingPath = useFakePack("0.20.0")
+		})
+
+		it.After(func() {
+			Expect(os.Setenv("PATH", existingPath)).To(Succeed())
+		})
+
+		it("should pack with a pull policy instead of the no-pull flag", func() {
+			app, err := dagger.NewPack(os.TempDir(),
+				dagger.SetImage("test-pack-image"),
+				dagger.NoPull(),
+			).Build()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(app.BuildLogs()).To(ContainSubstring("pack build test-pack-image --builder cloudfoundry/cnb:cflinuxfs3 --pull-policy never]"))
+		})
+	})
+
+	when("running an older pack", func() {
+		var existingPath string
+
+		it.Before(func() {
+			existingPath = useFakePack("0.8.2")
+		})
+
+		it.After(func() {
+			Expect(os.Setenv("PATH", existingPath)).To(Succeed())
+		})
+
+		it("should not pack with options that pack does not support", func() {
+			_, err := dagger.NewPack(os.TempDir(),
+				dagger.SetBinding("some-ca", "ca-certificates", nil),
+			).Build()
+			Expect(err).To(MatchError("SetBinding requires pack 0.10.0 or later, found pack 0.8.2"))
+
+			_, err = dagger.NewPack(os.TempDir(), dagger.SetOffline()).Build()
+			Expect(err).To(MatchError("SetOffline requires pack 0.9.0 or later, found pack 0.8.2"))
+		})
+	})
+}
+
+// useFakePack puts a fake pack reporting version first on $PATH, and returns
+// the previous $PATH.
+func useFakePack(version string) string {
+	existingPath := os.Getenv("PATH")
+	Expect(os.Setenv("PATH", hostPath)).To(Succeed())
+
+	fakePackCLI, err := gexec.Build("github.com/cloudfoundry/dagger/fakes/pack", "-ldflags", "-X main.version="+version)
+	Expect(err).NotTo(HaveOccurred())
+
+	Expect(os.Setenv("PATH", filepath.Dir(fakePackCLI)+string(os.PathListSeparator)+existingPath)).To(Succeed())
+
+	return existingPath
+}
+
+// syncBuffer is a bytes.Buffer that can be read while a build writes to it.
+type syncBuffer struct {
+	mutex  sync.Mutex
+	buffer bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.buffer.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.buffer.String()
+}
+
+// markerTarget returns where the pack arguments in output mount the marker of
+// a build.
+func markerTarget(output string) string {
+	match := regexp.MustCompile(`--volume \S+:(/dagger/[^\s\]]+)`).FindStringSubmatch(output)
+	if match == nil {
+		return ""
+	}
+
+	return match[1]
 }
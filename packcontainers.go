@@ -0,0 +1,206 @@
+package dagger
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// buildWatchInterval is how often the containers of a build that can be
+// stopped are listed while pack runs.
+var buildWatchInterval = 250 * time.Millisecond
+
+// buildContainers records the lifecycle containers pack starts for one build,
+// as it starts them, so that they can all be removed if the build does not
+// finish. pack cannot label or name them, so a container belongs to the build
+// when its command names the app image, when it mounts the marker directory
+// passed to pack with --volume, or when it shares a volume with a container
+// that belongs to the build. The phases that do not take the image, such as
+// detect and build with an untrusted builder, mount the marker, and restore
+// shares the layers volume of the other phases.
+type buildContainers struct {
+	runtime      ContainerRuntime
+	builderImage string
+	images       []string
+	since        time.Time
+
+	// marker is the host directory mounted at markerTarget, or empty if pack
+	// is too old to mount volumes
+	marker       string
+	markerTarget string
+
+	mutex sync.Mutex
+	seen  []ContainerSummary
+}
+
+func newBuildContainers(runtime ContainerRuntime, builderImage string, images []string, mountsVolumes bool) (*buildContainers, error) {
+	build := &buildContainers{
+		runtime:      runtime,
+		builderImage: builderImage,
+		images:       images,
+		since:        time.Now(),
+	}
+
+	if mountsVolumes {
+		marker, err := ioutil.TempDir("", "dagger-build")
+		if err != nil {
+			return nil, err
+		}
+
+		build.marker = marker
+		build.markerTarget = path.Join("/dagger", filepath.Base(marker))
+	}
+
+	return build, nil
+}
+
+// volumeArgs returns the pack arguments that mount the marker.
+func (b *buildContainers) volumeArgs() []string {
+	if b.marker == "" {
+		return nil
+	}
+
+	return []string{"--volume", fmt.Sprintf("%s:%s", b.marker, b.markerTarget)}
+}
+
+// watch records the containers of the build until done is closed or ctx is
+// done. Containers that come and go between two listings can only be found
+// through the ones listed after them.
+func (b *buildContainers) watch(ctx context.Context, done <-chan struct{}) {
+	ticker := time.NewTicker(buildWatchInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			_, _ = b.list(ctx)
+		}
+	}
+}
+
+// list records and returns the containers started from the builder since the
+// build started.
+func (b *buildContainers) list(ctx context.Context) ([]ContainerSummary, error) {
+	containers, err := b.runtime.ContainersFrom(ctx, b.builderImage, b.since)
+	if err != nil {
+		return nil, err
+	}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	for _, container := range containers {
+		found := false
+		for i, seen := range b.seen {
+			if seen.ID == container.ID {
+				b.seen[i] = container
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			b.seen = append(b.seen, container)
+		}
+	}
+
+	return containers, nil
+}
+
+// remove removes the containers of the build that still exist, in the order
+// they were first seen.
+func (b *buildContainers) remove() error {
+	ctx := context.Background()
+	containers, err := b.list(ctx)
+	if err != nil {
+		return err
+	}
+
+	existing := map[string]bool{}
+	for _, container := range containers {
+		existing[container.ID] = true
+	}
+
+	for _, id := range b.owned() {
+		if !existing[id] {
+			continue
+		}
+
+		err = b.runtime.Remove(ctx, id)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// owned returns the IDs of the containers seen that belong to the build.
+func (b *buildContainers) owned() []string {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	owned := map[string]bool{}
+	volumes := map[string]bool{}
+	for changed := true; changed; {
+		changed = false
+		for _, container := range b.seen {
+			if owned[container.ID] || !b.belongs(container, volumes) {
+				continue
+			}
+
+			owned[container.ID] = true
+			for _, mount := range container.Mounts {
+				if mount.Name != "" {
+					volumes[mount.Name] = true
+				}
+			}
+			changed = true
+		}
+	}
+
+	var ids []string
+	for _, container := range b.seen {
+		if owned[container.ID] {
+			ids = append(ids, container.ID)
+		}
+	}
+
+	return ids
+}
+
+func (b *buildContainers) belongs(container ContainerSummary, volumes map[string]bool) bool {
+	if commandNames(container.Command, b.images) {
+		return true
+	}
+
+	for _, mount := range container.Mounts {
+		if b.markerTarget != "" && mount.Destination == b.markerTarget {
+			return true
+		}
+
+		if mount.Name != "" && volumes[mount.Name] {
+			return true
+		}
+	}
+
+	return false
+}
+
+// close removes the marker directory.
+func (b *buildContainers) close() error {
+	if b.marker == "" {
+		return nil
+	}
+
+	return os.RemoveAll(b.marker)
+}
@@ -0,0 +1,112 @@
+package dagger
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"sync"
+
+	"github.com/paketo-buildpacks/packit/pexec"
+)
+
+// The pack releases that introduced the flags and commands dagger relies on.
+const (
+	packNetworkVersion       = "0.9.0"
+	packVolumeVersion        = "0.10.0"
+	packBuilderCreateVersion = "0.15.0"
+	packPullPolicyVersion    = "0.20.0"
+)
+
+var (
+	packVersionPattern = regexp.MustCompile(`(\d+)\.(\d+)\.(\d+)`)
+
+	packVersions      = map[string]packVersion{}
+	packVersionsMutex sync.Mutex
+)
+
+type packVersion struct {
+	major, minor, patch int
+}
+
+func parsePackVersion(output string) (packVersion, error) {
+	match := packVersionPattern.FindStringSubmatch(output)
+	if match == nil {
+		return packVersion{}, fmt.Errorf("failed to parse pack version from %q", output)
+	}
+
+	var version packVersion
+	version.major, _ = strconv.Atoi(match[1])
+	version.minor, _ = strconv.Atoi(match[2])
+	version.patch, _ = strconv.Atoi(match[3])
+	return version, nil
+}
+
+// atLeast reports whether v is the same as or newer than minimum, which must
+// be a valid version.
+func (v packVersion) atLeast(minimum string) bool {
+	other, err := parsePackVersion(minimum)
+	if err != nil {
+		panic(err)
+	}
+
+	if v.major != other.major {
+		return v.major > other.major
+	}
+
+	if v.minor != other.minor {
+		return v.minor > other.minor
+	}
+
+	return v.patch >= other.patch
+}
+
+func (v packVersion) String() string {
+	return fmt.Sprintf("%d.%d.%d", v.major, v.minor, v.patch)
+}
+
+// require returns an error naming option when the installed pack
+// is older than minimum.
+func (v packVersion) require(option, minimum string) error {
+	if !v.atLeast(minimum) {
+		return fmt.Errorf("%s requires pack %s or later, found pack %s", option, minimum, v)
+	}
+
+	return nil
+}
+
+// installedPackVersion runs `pack version` once per pack binary on $PATH
+// and caches the result for the rest of the process.
+func installedPackVersion(executable Executable) (packVersion, error) {
+	path, err := exec.LookPath("pack")
+	if err != nil {
+		return packVersion{}, fmt.Errorf("failed to find pack: %w", err)
+	}
+
+	packVersionsMutex.Lock()
+	defer packVersionsMutex.Unlock()
+
+	if version, ok := packVersions[path]; ok {
+		return version, nil
+	}
+
+	stdout := bytes.NewBuffer(nil)
+	stderr := bytes.NewBuffer(nil)
+	err = executable.Execute(pexec.Execution{
+		Args:   []string{"version"},
+		Stdout: stdout,
+		Stderr: stderr,
+	})
+	if err != nil {
+		return packVersion{}, fmt.Errorf("failed to get pack version: %w: %s", err, stderr)
+	}
+
+	version, err := parsePackVersion(stdout.String())
+	if err != nil {
+		return packVersion{}, err
+	}
+
+	packVersions[path] = version
+	return version, nil
+}
@@ -0,0 +1,552 @@
+package dagger
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// PodmanRuntime runs containers through the podman CLI, which works on hosts
+// that only have rootless podman available.
+type PodmanRuntime struct{}
+
+func NewPodmanRuntime() PodmanRuntime {
+	return PodmanRuntime{}
+}
+
+func (p PodmanRuntime) Run(ctx context.Context, config RunConfig) (string, error) {
+	return p.create(ctx, append([]string{"run", "-d"}, p.createArgs(config)...), config.Image)
+}
+
+// Create creates a container without starting it.
+func (p PodmanRuntime) Create(ctx context.Context, config RunConfig) (string, error) {
+	return p.create(ctx, append([]string{"create"}, p.createArgs(config)...), config.Image)
+}
+
+func (p PodmanRuntime) create(ctx context.Context, args []string, image string) (string, error) {
+	stdout, err := p.run(ctx, args...)
+	if err != nil {
+		return "", fmt.Errorf("failed to run podman image %s: %w", image, err)
+	}
+
+	id := strings.TrimSpace(stdout)
+	if id == "" {
+		return "", fmt.Errorf("podman did not return a container id for image %s", image)
+	}
+
+	return shortID(id), nil
+}
+
+func (p PodmanRuntime) createArgs(config RunConfig) []string {
+	var args []string
+	for _, port := range config.Ports {
+		if config.HostIP != "" {
+			port = fmt.Sprintf("%s::%s", config.HostIP, port)
+		}
+		args = append(args, "-p", port)
+	}
+
+	// Publishing all exposed ports would bypass HostIP
+	if len(config.Ports) > 0 && config.HostIP == "" {
+		args = append(args, "-P")
+	}
+
+	if config.Memory != "" {
+		args = append(args, "--memory", config.Memory)
+	}
+
+	args = append(args, runOptionArgs(config.Options)...)
+
+	if config.Network != "" {
+		args = append(args, "--network", config.Network)
+		for _, alias := range config.NetworkAliases {
+			args = append(args, "--network-alias", alias)
+		}
+	}
+
+	for _, mount := range config.Mounts {
+		spec := fmt.Sprintf("type=%s,target=%s", mount.Type, mount.Target)
+		if mount.Source != "" {
+			spec = fmt.Sprintf("type=%s,source=%s,target=%s", mount.Type, mount.Source, mount.Target)
+		}
+
+		if mount.ReadOnly {
+			spec += ",ro=true"
+		}
+
+		args = append(args, "--mount", spec)
+	}
+
+	if config.HealthCheck != nil && len(config.HealthCheck.Test) > 1 {
+		args = append(args, "--health-cmd", strings.Join(config.HealthCheck.Test[1:], " "))
+
+		if config.HealthCheck.Interval != 0 {
+			args = append(args, "--health-interval", config.HealthCheck.Interval.String())
+		}
+
+		if config.HealthCheck.Timeout != 0 {
+			args = append(args, "--health-timeout", config.HealthCheck.Timeout.String())
+		}
+	}
+
+	for _, env := range envList(config.Env) {
+		args = append(args, "-e", env)
+	}
+
+	args = append(args, config.Image)
+	return append(args, config.Command...)
+}
+
+func runOptionArgs(options RunOptions) []string {
+	var args []string
+	if options.CPUs != 0 {
+		args = append(args, "--cpus", strconv.FormatFloat(options.CPUs, 'f', -1, 64))
+	}
+
+	if options.PidsLimit != 0 {
+		args = append(args, "--pids-limit", strconv.FormatInt(options.PidsLimit, 10))
+	}
+
+	if options.ReadOnly {
+		args = append(args, "--read-only")
+	}
+
+	var mounts []string
+	for mountPath := range options.Tmpfs {
+		mounts = append(mounts, mountPath)
+	}
+	sort.Strings(mounts)
+
+	for _, mountPath := range mounts {
+		mount := mountPath
+		if options.Tmpfs[mountPath] != "" {
+			mount = fmt.Sprintf("%s:%s", mountPath, options.Tmpfs[mountPath])
+		}
+		args = append(args, "--tmpfs", mount)
+	}
+
+	if options.User != "" {
+		args = append(args, "--user", options.User)
+	}
+
+	for _, capability := range options.CapDrop {
+		args = append(args, "--cap-drop", capability)
+	}
+
+	for _, capability := range options.CapAdd {
+		args = append(args, "--cap-add", capability)
+	}
+
+	for _, ulimit := range options.Ulimits {
+		args = append(args, "--ulimit", fmt.Sprintf("%s=%d:%d", ulimit.Name, ulimit.Soft, ulimit.Hard))
+	}
+
+	return args
+}
+
+// ContainersFrom lists the containers created from image, or from images
+// built on it, since a point in time.
+func (p PodmanRuntime) ContainersFrom(ctx context.Context, image string, since time.Time) ([]ContainerSummary, error) {
+	stdout, err := p.run(ctx, "ps", "-a", "--filter", fmt.Sprintf("ancestor=%s", image), "--format", "json")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list containers from image %s: %w", image, err)
+	}
+
+	var containers []struct {
+		ID      string   `json:"Id"`
+		Image   string   `json:"Image"`
+		Command []string `json:"Command"`
+		Created int64    `json:"Created"`
+		Mounts  []string `json:"Mounts"`
+	}
+
+	err = json.Unmarshal([]byte(stdout), &containers)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse container list: %w", err)
+	}
+
+	var summaries []ContainerSummary
+	for _, container := range containers {
+		if container.Created >= since.Unix() {
+			summary := ContainerSummary{
+				ID:      shortID(container.ID),
+				Image:   container.Image,
+				Command: strings.Join(container.Command, " "),
+				Created: container.Created,
+			}
+
+			// podman only lists where containers mount things
+			for _, destination := range container.Mounts {
+				summary.Mounts = append(summary.Mounts, MountPoint{Destination: destination})
+			}
+
+			summaries = append(summaries, summary)
+		}
+	}
+
+	return summaries, nil
+}
+
+// Inspect returns the state of a container. Podman only runs health checks on
+// a timer when systemd is available, so a check is triggered manually while
+// the container is still starting.
+func (p PodmanRuntime) Inspect(ctx context.Context, id string) (ContainerState, error) {
+	state, err := p.inspect(ctx, id)
+	if err != nil {
+		return ContainerState{}, err
+	}
+
+	if state.Health != nil && state.Health.Status == "starting" {
+		// A failing check exits non-zero, its result is recorded in the health log
+		_, _ = p.run(ctx, "healthcheck", "run", id)
+
+		state, err = p.inspect(ctx, id)
+		if err != nil {
+			return ContainerState{}, err
+		}
+	}
+
+	return state, nil
+}
+
+func (p PodmanRuntime) inspect(ctx context.Context, id string) (ContainerState, error) {
+	stdout, err := p.run(ctx, "inspect", "--format", "json", id)
+	if err != nil {
+		return ContainerState{}, fmt.Errorf("failed to inspect container %s: %w", id, err)
+	}
+
+	var containers []struct {
+		State struct {
+			ContainerState
+			// Podman releases before 4.3 report health under this key
+			Healthcheck *Health `json:"Healthcheck"`
+		} `json:"State"`
+	}
+
+	err = json.Unmarshal([]byte(stdout), &containers)
+	if err != nil {
+		return ContainerState{}, fmt.Errorf("failed to parse inspect output of container %s: %w", id, err)
+	}
+
+	if len(containers) == 0 {
+		return ContainerState{}, fmt.Errorf("no such container: %s", id)
+	}
+
+	state := containers[0].State.ContainerState
+	if state.Health == nil {
+		state.Health = containers[0].State.Healthcheck
+	}
+
+	// Podman reports an empty health status for containers without a check
+	if state.Health != nil && state.Health.Status == "" {
+		state.Health = nil
+	}
+
+	return state, nil
+}
+
+func (p PodmanRuntime) Logs(ctx context.Context, id string) (string, error) {
+	buffer := bytes.NewBuffer(nil)
+	cmd := p.command(ctx, "logs", id)
+	cmd.Stdout = buffer
+	cmd.Stderr = buffer
+
+	err := cmd.Run()
+	if err != nil {
+		return "", fmt.Errorf("failed to get logs of container %s: %w", id, err)
+	}
+
+	return buffer.String(), nil
+}
+
+// FollowLogs streams the output of `podman logs -f` until the container stops
+// or the context is cancelled.
+func (p PodmanRuntime) FollowLogs(ctx context.Context, id string) (io.ReadCloser, error) {
+	reader, writer := io.Pipe()
+	cmd := p.command(ctx, "logs", "-f", id)
+	cmd.Stdout = writer
+	cmd.Stderr = writer
+
+	err := cmd.Start()
+	if err != nil {
+		return nil, fmt.Errorf("failed to follow logs of container %s: %w", id, err)
+	}
+
+	go func() {
+		writer.CloseWithError(cmd.Wait())
+	}()
+
+	return reader, nil
+}
+
+func (p PodmanRuntime) Exec(ctx context.Context, id string, cmd []string, options ExecOptions) (ExecResult, error) {
+	args := []string{"exec"}
+	if options.User != "" {
+		args = append(args, "--user", options.User)
+	}
+
+	if options.WorkingDir != "" {
+		args = append(args, "--workdir", options.WorkingDir)
+	}
+
+	for _, env := range envList(options.Env) {
+		args = append(args, "-e", env)
+	}
+
+	args = append(args, id)
+	args = append(args, cmd...)
+
+	stdout := bytes.NewBuffer(nil)
+	stderr := bytes.NewBuffer(nil)
+	command := p.command(ctx, args...)
+	command.Stdout = stdout
+	command.Stderr = stderr
+
+	err := command.Run()
+	result := ExecResult{Stdout: stdout.String(), Stderr: stderr.String()}
+
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && ctx.Err() == nil {
+		result.ExitCode = exitErr.ExitCode()
+		return result, nil
+	}
+
+	if err != nil {
+		return result, fmt.Errorf("failed to exec %q in container %s: %w", cmd, id, err)
+	}
+
+	return result, nil
+}
+
+// CopyFrom streams the tar archive `podman cp` writes for path.
+func (p PodmanRuntime) CopyFrom(ctx context.Context, id, path string) (io.ReadCloser, error) {
+	stream, err := p.stream(ctx, "cp", fmt.Sprintf("%s:%s", id, path), "-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to copy %s from container %s: %w", path, id, err)
+	}
+
+	return stream, nil
+}
+
+func (p PodmanRuntime) Stop(ctx context.Context, id string) error {
+	_, err := p.run(ctx, "stop", id)
+	if err != nil {
+		return fmt.Errorf("failed to stop container %s: %w", id, err)
+	}
+
+	return nil
+}
+
+func (p PodmanRuntime) Remove(ctx context.Context, id string) error {
+	_, err := p.run(ctx, "rm", "-f", "--volumes", id)
+	if err != nil {
+		return fmt.Errorf("failed to remove container %s: %w", id, err)
+	}
+
+	return nil
+}
+
+// Ports parses `podman port` output, whose lines look like
+// "8080/tcp -> 0.0.0.0:40123" or "8080/tcp -> [::]:40123".
+func (p PodmanRuntime) Ports(ctx context.Context, id string) ([]PortMapping, error) {
+	stdout, err := p.run(ctx, "port", id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get ports of container %s: %w", id, err)
+	}
+
+	var mappings []PortMapping
+	scanner := bufio.NewScanner(strings.NewReader(stdout))
+	for scanner.Scan() {
+		parts := strings.Split(scanner.Text(), " -> ")
+		if len(parts) != 2 {
+			continue
+		}
+
+		separator := strings.LastIndex(parts[1], ":")
+		if separator < 0 {
+			continue
+		}
+
+		mappings = append(mappings, PortMapping{
+			ContainerPort: strings.TrimSpace(parts[0]),
+			HostIP:        strings.Trim(parts[1][:separator], "[]"),
+			HostPort:      strings.TrimSpace(parts[1][separator+1:]),
+		})
+	}
+
+	return mappings, nil
+}
+
+func (p PodmanRuntime) Exists(ctx context.Context, name string) (bool, error) {
+	if name == "" {
+		return false, nil
+	}
+
+	for _, kind := range []string{"container", "image", "volume"} {
+		_, err := p.run(ctx, kind, "exists", name)
+		if err == nil {
+			return true, nil
+		}
+
+		var exitErr *exec.ExitError
+		if !errors.As(err, &exitErr) || exitErr.ExitCode() != 1 {
+			return false, fmt.Errorf("failed to check whether %s %s exists: %w", kind, name, err)
+		}
+	}
+
+	return false, nil
+}
+
+func (p PodmanRuntime) InspectImage(ctx context.Context, name string) (ImageJSON, error) {
+	stdout, err := p.run(ctx, "image", "inspect", "--format", "json", name)
+	if err != nil {
+		return ImageJSON{}, fmt.Errorf("failed to inspect image %s: %w", name, err)
+	}
+
+	var images []ImageJSON
+	err = json.Unmarshal([]byte(stdout), &images)
+	if err != nil {
+		return ImageJSON{}, fmt.Errorf("failed to parse inspect output of image %s: %w", name, err)
+	}
+
+	if len(images) == 0 {
+		return ImageJSON{}, fmt.Errorf("no such image: %s", name)
+	}
+
+	return images[0], nil
+}
+
+// SaveImage streams the docker-archive tarball `podman save` writes.
+func (p PodmanRuntime) SaveImage(ctx context.Context, name string) (io.ReadCloser, error) {
+	stream, err := p.stream(ctx, "save", "--format", "docker-archive", name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to save image %s: %w", name, err)
+	}
+
+	return stream, nil
+}
+
+// PullImage pulls an image, without TLS verification for registries on
+// localhost, which the docker daemon treats as insecure too.
+func (p PodmanRuntime) PullImage(ctx context.Context, name string) error {
+	args := []string{"pull"}
+	if strings.HasPrefix(name, "localhost:") || strings.HasPrefix(name, "127.0.0.1:") {
+		args = append(args, "--tls-verify=false")
+	}
+
+	_, err := p.run(ctx, append(args, name)...)
+	if err != nil {
+		return fmt.Errorf("failed to pull image %s: %w", name, err)
+	}
+
+	return nil
+}
+
+func (p PodmanRuntime) RemoveImage(ctx context.Context, name string) error {
+	_, err := p.run(ctx, "rmi", "-f", name)
+	if err != nil {
+		return fmt.Errorf("failed to remove image %s: %w", name, err)
+	}
+
+	return nil
+}
+
+func (p PodmanRuntime) RemoveVolume(ctx context.Context, name string) error {
+	_, err := p.run(ctx, "volume", "rm", name)
+	if err != nil {
+		return fmt.Errorf("failed to remove volume %s: %w", name, err)
+	}
+
+	return nil
+}
+
+func (p PodmanRuntime) Volumes(ctx context.Context) ([]string, error) {
+	stdout, err := p.run(ctx, "volume", "ls", "-q")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list volumes: %w", err)
+	}
+
+	return strings.Fields(stdout), nil
+}
+
+func (p PodmanRuntime) PruneImages(ctx context.Context) error {
+	_, err := p.run(ctx, "image", "prune", "-f")
+	if err != nil {
+		return fmt.Errorf("failed to prune images: %w", err)
+	}
+
+	return nil
+}
+
+func (p PodmanRuntime) CreateNetwork(ctx context.Context, name string) error {
+	_, err := p.run(ctx, "network", "create", name)
+	if err != nil {
+		return fmt.Errorf("failed to create network %s: %w", name, err)
+	}
+
+	return nil
+}
+
+func (p PodmanRuntime) RemoveNetwork(ctx context.Context, name string) error {
+	_, err := p.run(ctx, "network", "rm", name)
+	if err != nil {
+		return fmt.Errorf("failed to remove network %s: %w", name, err)
+	}
+
+	return nil
+}
+
+func (p PodmanRuntime) run(ctx context.Context, args ...string) (string, error) {
+	stdout := bytes.NewBuffer(nil)
+	stderr := bytes.NewBuffer(nil)
+	cmd := p.command(ctx, args...)
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+
+	err := cmd.Run()
+	if err != nil {
+		return stdout.String(), fmt.Errorf("%w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	return stdout.String(), nil
+}
+
+// command is how every podman invocation is made, so that all of them are
+// killed once ctx is done.
+func (p PodmanRuntime) command(ctx context.Context, args ...string) *exec.Cmd {
+	return exec.CommandContext(ctx, "podman", args...)
+}
+
+// stream runs podman in the background and returns its stdout. A failure
+// exit surfaces as an error from the reader once the output is consumed.
+func (p PodmanRuntime) stream(ctx context.Context, args ...string) (io.ReadCloser, error) {
+	reader, writer := io.Pipe()
+	stderr := bytes.NewBuffer(nil)
+	cmd := p.command(ctx, args...)
+	cmd.Stdout = writer
+	cmd.Stderr = stderr
+
+	err := cmd.Start()
+	if err != nil {
+		return nil, err
+	}
+
+	go func() {
+		err := cmd.Wait()
+		if err != nil {
+			err = fmt.Errorf("podman %s: %w: %s", args[0], err, strings.TrimSpace(stderr.String()))
+		}
+		writer.CloseWithError(err)
+	}()
+
+	return reader, nil
+}
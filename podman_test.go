@@ -0,0 +1,316 @@
+package dagger_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/cloudfoundry/dagger"
+	"github.com/onsi/gomega/gexec"
+	"github.com/sclevine/spec"
+
+	. "github.com/onsi/gomega"
+)
+
+// podmanRule scripts a reply of the fake podman, see fakes/podman.
+type podmanRule struct {
+	Args       []string `json:"args"`
+	Times      int      `json:"times,omitempty"`
+	Stdout     string   `json:"stdout,omitempty"`
+	StdoutFile string   `json:"stdout_file,omitempty"`
+	Stderr     string   `json:"stderr,omitempty"`
+	ExitCode   int      `json:"exit_code,omitempty"`
+	Hang       bool     `json:"hang,omitempty"`
+}
+
+func testPodmanRuntime(t *testing.T, when spec.G, it spec.S) {
+	var (
+		tmpDir       string
+		existingPath string
+		runtime      dagger.PodmanRuntime
+		rules        []podmanRule
+	)
+
+	it.Before(func() {
+		var err error
+		tmpDir, err = ioutil.TempDir("", "podman")
+		Expect(err).NotTo(HaveOccurred())
+
+		existingPath = os.Getenv("PATH")
+		Expect(os.Setenv("PATH", hostPath)).To(Succeed())
+
+		fakePodmanCLI, err := gexec.Build("github.com/cloudfoundry/dagger/fakes/podman")
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(os.Setenv("PATH", filepath.Dir(fakePodmanCLI)+string(os.PathListSeparator)+existingPath)).To(Succeed())
+		Expect(os.Setenv("FAKE_PODMAN_CALLS", filepath.Join(tmpDir, "calls"))).To(Succeed())
+		Expect(os.Setenv("FAKE_PODMAN_RULES", filepath.Join(tmpDir, "rules.json"))).To(Succeed())
+
+		rules = nil
+		runtime = dagger.NewPodmanRuntime()
+	})
+
+	it.After(func() {
+		Expect(os.Setenv("PATH", existingPath)).To(Succeed())
+		Expect(os.Unsetenv("FAKE_PODMAN_CALLS")).To(Succeed())
+		Expect(os.Unsetenv("FAKE_PODMAN_RULES")).To(Succeed())
+		Expect(os.RemoveAll(tmpDir)).To(Succeed())
+	})
+
+	reply := func(rule podmanRule) {
+		rules = append(rules, rule)
+
+		content, err := json.Marshal(rules)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ioutil.WriteFile(filepath.Join(tmpDir, "rules.json"), content, 0644)).To(Succeed())
+	}
+
+	calls := func() [][]string {
+		content, err := ioutil.ReadFile(filepath.Join(tmpDir, "calls"))
+		if os.IsNotExist(err) {
+			return nil
+		}
+		Expect(err).NotTo(HaveOccurred())
+
+		var calls [][]string
+		for _, line := range bytes.Split(bytes.TrimSpace(content), []byte("\n")) {
+			var call []string
+			Expect(json.Unmarshal(line, &call)).To(Succeed())
+			calls = append(calls, call)
+		}
+
+		return calls
+	}
+
+	when("running a container", func() {
+		it("passes the config as flags and returns the short id", func() {
+			reply(podmanRule{Args: []string{"run"}, Stdout: "0123456789abcdef0123\n"})
+
+			id, err := runtime.Run(context.Background(), dagger.RunConfig{
+				Image:   "some-image",
+				Ports:   []string{"8080"},
+				HostIP:  "127.0.0.1",
+				Memory:  "512m",
+				Env:     map[string]string{"SOME_VAR": "some-value"},
+				Command: []string{"some-command"},
+				Mounts:  []dagger.Mount{{Type: dagger.MountTypeVolume, Source: "some-volume", Target: "/data", ReadOnly: true}},
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(id).To(Equal("0123456789ab"))
+
+			Expect(calls()).To(Equal([][]string{{
+				"run", "-d",
+				"-p", "127.0.0.1::8080",
+				"--memory", "512m",
+				"--mount", "type=volume,source=some-volume,target=/data,ro=true",
+				"-e", "SOME_VAR=some-value",
+				"some-image", "some-command",
+			}}))
+		})
+
+		it("reports the error podman printed", func() {
+			reply(podmanRule{Args: []string{"run"}, Stderr: "Error: port is already allocated\n", ExitCode: 125})
+
+			_, err := runtime.Run(context.Background(), dagger.RunConfig{Image: "some-image"})
+			Expect(err).To(MatchError(ContainSubstring("failed to run podman image some-image")))
+			Expect(err).To(MatchError(ContainSubstring("Error: port is already allocated")))
+		})
+
+		it("stops podman once the context is done", func() {
+			reply(podmanRule{Args: []string{"run"}, Hang: true})
+
+			ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+			defer cancel()
+
+			started := time.Now()
+			_, err := runtime.Run(ctx, dagger.RunConfig{Image: "some-image"})
+			Expect(err).To(HaveOccurred())
+			Expect(time.Since(started)).To(BeNumerically("<", 10*time.Second))
+		})
+	})
+
+	when("looking up ports", func() {
+		it("parses IPv4 and IPv6 bindings", func() {
+			reply(podmanRule{Args: []string{"port", "some-id"}, Stdout: "8080/tcp -> 0.0.0.0:40123\n8080/tcp -> [::]:40124\nunexpected\n"})
+
+			ports, err := runtime.Ports(context.Background(), "some-id")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(ports).To(Equal([]dagger.PortMapping{
+				{ContainerPort: "8080/tcp", HostIP: "0.0.0.0", HostPort: "40123"},
+				{ContainerPort: "8080/tcp", HostIP: "::", HostPort: "40124"},
+			}))
+		})
+	})
+
+	when("listing the containers from an image", func() {
+		it("returns the ones created since then with where they mount things", func() {
+			reply(podmanRule{Args: []string{"ps"}, Stdout: `[
+				{"Id": "0123456789abcdef", "Image": "some-builder", "Command": ["/cnb/lifecycle/detector", "-app", "/workspace"], "Created": 2000, "Mounts": ["/layers", "/workspace"]},
+				{"Id": "fedcba9876543210", "Image": "some-builder", "Command": ["/cnb/lifecycle/creator"], "Created": 1000}
+			]`})
+
+			containers, err := runtime.ContainersFrom(context.Background(), "some-builder", time.Unix(1500, 0))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(containers).To(Equal([]dagger.ContainerSummary{{
+				ID:      "0123456789ab",
+				Image:   "some-builder",
+				Command: "/cnb/lifecycle/detector -app /workspace",
+				Created: 2000,
+				Mounts:  []dagger.MountPoint{{Destination: "/layers"}, {Destination: "/workspace"}},
+			}}))
+			Expect(calls()).To(Equal([][]string{{"ps", "-a", "--filter", "ancestor=some-builder", "--format", "json"}}))
+		})
+	})
+
+	when("inspecting a container", func() {
+		it("returns its state without a health check", func() {
+			reply(podmanRule{Args: []string{"inspect"}, Stdout: `[{"State": {"Status": "running", "Running": true, "Health": {"Status": ""}}}]`})
+
+			state, err := runtime.Inspect(context.Background(), "some-id")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(state).To(Equal(dagger.ContainerState{Status: "running", Running: true}))
+			Expect(calls()).To(Equal([][]string{{"inspect", "--format", "json", "some-id"}}))
+		})
+
+		it("runs the health check of a starting container", func() {
+			reply(podmanRule{Args: []string{"inspect"}, Times: 1, Stdout: `[{"State": {"Running": true, "Healthcheck": {"Status": "starting"}}}]`})
+			reply(podmanRule{Args: []string{"healthcheck"}, Stdout: "unhealthy\n", ExitCode: 1})
+			reply(podmanRule{Args: []string{"inspect"}, Stdout: `[{"State": {"Running": true, "Healthcheck": {"Status": "healthy"}}}]`})
+
+			state, err := runtime.Inspect(context.Background(), "some-id")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(state.Health.Status).To(Equal("healthy"))
+			Expect(calls()).To(Equal([][]string{
+				{"inspect", "--format", "json", "some-id"},
+				{"healthcheck", "run", "some-id"},
+				{"inspect", "--format", "json", "some-id"},
+			}))
+		})
+
+		it("fails for missing containers", func() {
+			reply(podmanRule{Args: []string{"inspect"}, Stdout: "[]"})
+
+			_, err := runtime.Inspect(context.Background(), "missing")
+			Expect(err).To(MatchError("no such container: missing"))
+		})
+	})
+
+	when("checking whether something exists", func() {
+		it("falls through containers, images and volumes", func() {
+			reply(podmanRule{Args: []string{"container", "exists"}, ExitCode: 1})
+			reply(podmanRule{Args: []string{"image", "exists"}, ExitCode: 1})
+
+			exists, err := runtime.Exists(context.Background(), "some-volume")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(exists).To(BeTrue())
+			Expect(calls()).To(Equal([][]string{
+				{"container", "exists", "some-volume"},
+				{"image", "exists", "some-volume"},
+				{"volume", "exists", "some-volume"},
+			}))
+		})
+
+		it("returns false when nothing matches", func() {
+			reply(podmanRule{Args: []string{}, ExitCode: 1})
+
+			exists, err := runtime.Exists(context.Background(), "missing")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(exists).To(BeFalse())
+
+			exists, err = runtime.Exists(context.Background(), "")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(exists).To(BeFalse())
+			Expect(calls()).To(HaveLen(3))
+		})
+
+		it("returns podman errors", func() {
+			reply(podmanRule{Args: []string{"container", "exists"}, Stderr: "Error: cannot connect", ExitCode: 125})
+
+			_, err := runtime.Exists(context.Background(), "some-name")
+			Expect(err).To(MatchError(ContainSubstring("failed to check whether container some-name exists")))
+			Expect(err).To(MatchError(ContainSubstring("Error: cannot connect")))
+		})
+	})
+
+	when("executing a command", func() {
+		it("returns its output and exit code", func() {
+			reply(podmanRule{Args: []string{"exec"}, Stdout: "some-output", Stderr: "some-error", ExitCode: 3})
+
+			result, err := runtime.Exec(context.Background(), "some-id", []string{"ls", "/"}, dagger.ExecOptions{
+				User:       "some-user",
+				WorkingDir: "/workspace",
+				Env:        map[string]string{"SOME_VAR": "some-value"},
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result).To(Equal(dagger.ExecResult{Stdout: "some-output", Stderr: "some-error", ExitCode: 3}))
+			Expect(calls()).To(Equal([][]string{{
+				"exec", "--user", "some-user", "--workdir", "/workspace", "-e", "SOME_VAR=some-value", "some-id", "ls", "/",
+			}}))
+		})
+
+		it("fails once the context is done", func() {
+			reply(podmanRule{Args: []string{"exec"}, Hang: true})
+
+			ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+			defer cancel()
+
+			_, err := runtime.Exec(ctx, "some-id", []string{"sleep", "infinity"}, dagger.ExecOptions{})
+			Expect(err).To(MatchError(ContainSubstring(`failed to exec ["sleep" "infinity"] in container some-id`)))
+		})
+	})
+
+	when("copying files from a container", func() {
+		it("streams the archive podman writes", func() {
+			archive := bytes.NewBuffer(nil)
+			writer := tar.NewWriter(archive)
+			Expect(writer.WriteHeader(&tar.Header{Name: "some-file", Mode: 0644, Size: 12})).To(Succeed())
+			_, err := writer.Write([]byte("some-content"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(writer.Close()).To(Succeed())
+
+			archivePath := filepath.Join(tmpDir, "archive.tar")
+			Expect(ioutil.WriteFile(archivePath, archive.Bytes(), 0644)).To(Succeed())
+			reply(podmanRule{Args: []string{"cp"}, StdoutFile: archivePath})
+
+			stream, err := runtime.CopyFrom(context.Background(), "some-id", "/workspace/some-file")
+			Expect(err).NotTo(HaveOccurred())
+			defer stream.Close()
+
+			reader := tar.NewReader(stream)
+			header, err := reader.Next()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(header.Name).To(Equal("some-file"))
+			Expect(ioutil.ReadAll(reader)).To(Equal([]byte("some-content")))
+
+			Expect(calls()).To(Equal([][]string{{"cp", "some-id:/workspace/some-file", "-"}}))
+		})
+
+		it("surfaces a failed copy when the stream is read", func() {
+			reply(podmanRule{Args: []string{"cp"}, Stderr: "Error: no such file", ExitCode: 125})
+
+			stream, err := runtime.CopyFrom(context.Background(), "some-id", "/missing")
+			Expect(err).NotTo(HaveOccurred())
+			defer stream.Close()
+
+			_, err = ioutil.ReadAll(stream)
+			Expect(err).To(MatchError(ContainSubstring("Error: no such file")))
+		})
+	})
+
+	when("pulling an image", func() {
+		it("skips TLS verification for local registries only", func() {
+			Expect(runtime.PullImage(context.Background(), "localhost:5000/some-image")).To(Succeed())
+			Expect(runtime.PullImage(context.Background(), "some-image")).To(Succeed())
+			Expect(calls()).To(Equal([][]string{
+				{"pull", "--tls-verify=false", "localhost:5000/some-image"},
+				{"pull", "some-image"},
+			}))
+		})
+	})
+}
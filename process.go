@@ -0,0 +1,97 @@
+package dagger
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/paketo-buildpacks/packit/pexec"
+)
+
+// contextExecutable is an Executable that can be stopped before it
+// finishes.
+type contextExecutable interface {
+	Executable
+	ExecuteContext(ctx context.Context, execution pexec.Execution) error
+}
+
+// groupExecutable runs an executable the way pexec.Executable does, looking
+// it up on the PATH of the execution's Env when that sets one. It runs in a
+// process group of its own, so that everything it started can be killed
+// along with it.
+type groupExecutable struct {
+	name string
+}
+
+func newGroupExecutable(name string) groupExecutable {
+	return groupExecutable{
+		name: name,
+	}
+}
+
+func (e groupExecutable) Execute(execution pexec.Execution) error {
+	return e.ExecuteContext(context.Background(), execution)
+}
+
+// ExecuteContext kills the process group of the executable once ctx is done,
+// waits for it to exit and returns an error wrapping ctx.Err().
+func (e groupExecutable) ExecuteContext(ctx context.Context, execution pexec.Execution) error {
+	path, err := e.lookPath(execution.Env)
+	if err != nil {
+		return err
+	}
+
+	cmd := exec.Command(path, execution.Args...)
+	cmd.Dir = execution.Dir
+	if len(execution.Env) > 0 {
+		cmd.Env = execution.Env
+	}
+	cmd.Stdout = execution.Stdout
+	cmd.Stderr = execution.Stderr
+	startProcessGroup(cmd)
+
+	err = cmd.Start()
+	if err != nil {
+		return err
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd.Wait()
+	}()
+
+	select {
+	case err = <-done:
+		return err
+	case <-ctx.Done():
+	}
+
+	err = killProcessGroup(cmd)
+	if err != nil {
+		return fmt.Errorf("failed to kill %s after %s: %w", e.name, ctx.Err(), err)
+	}
+	<-done
+
+	return fmt.Errorf("%s did not finish: %w", e.name, ctx.Err())
+}
+
+// lookPath finds the executable on the PATH set in env, or else on $PATH,
+// without changing the environment of the process like pexec does.
+func (e groupExecutable) lookPath(env []string) (string, error) {
+	for _, variable := range env {
+		if !strings.HasPrefix(variable, "PATH=") {
+			continue
+		}
+
+		for _, dir := range filepath.SplitList(strings.TrimPrefix(variable, "PATH=")) {
+			path, err := exec.LookPath(filepath.Join(dir, e.name))
+			if err == nil {
+				return path, nil
+			}
+		}
+	}
+
+	return exec.LookPath(e.name)
+}
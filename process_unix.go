@@ -0,0 +1,19 @@
+//go:build !windows
+// +build !windows
+
+package dagger
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// startProcessGroup makes the command lead a new process group, so that it
+// can be killed along with every process it started.
+func startProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
+
+func killProcessGroup(cmd *exec.Cmd) error {
+	return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+}
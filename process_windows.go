@@ -0,0 +1,11 @@
+package dagger
+
+import "os/exec"
+
+// startProcessGroup is a no-op on windows, which has no process groups.
+func startProcessGroup(cmd *exec.Cmd) {}
+
+// killProcessGroup only kills the command itself on windows.
+func killProcessGroup(cmd *exec.Cmd) error {
+	return cmd.Process.Kill()
+}
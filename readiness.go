@@ -0,0 +1,207 @@
+package dagger
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"regexp"
+	"time"
+)
+
+// ReadinessCheck decides when a started app is ready to be tested. It is
+// polled until it reports ready, returns an error or the start times out.
+type ReadinessCheck interface {
+	Check(ctx context.Context, app *App) (bool, error)
+}
+
+// runConfigurer is implemented by readiness checks that need the container
+// to be set up in a particular way before it is started.
+type runConfigurer interface {
+	configure(app *App, config *RunConfig) error
+}
+
+// Ready reports whether the started app container is running and passes the
+// readiness check it was started with.
+func (a *App) Ready() (bool, error) {
+	if a.ContainerID == "" || a.startReadiness == nil {
+		return false, fmt.Errorf("app %s has not been started", a.fixtureName)
+	}
+
+	runtime, err := a.containerRuntime()
+	if err != nil {
+		return false, err
+	}
+
+	ctx := context.Background()
+	state, err := runtime.Inspect(ctx, a.ContainerID)
+	if err != nil {
+		return false, err
+	}
+
+	if !state.Running {
+		return false, nil
+	}
+
+	return a.startReadiness.Check(ctx, a)
+}
+
+// ReadinessFunc adapts an ordinary function into a ReadinessCheck.
+type ReadinessFunc func(ctx context.Context, app *App) (bool, error)
+
+func (f ReadinessFunc) Check(ctx context.Context, app *App) (bool, error) {
+	return f(ctx, app)
+}
+
+// HTTPReadiness is ready once a GET of path on $PORT, made from the host,
+// responds with status. A status of 0 accepts any status below 400, like
+// `curl --fail` does.
+func HTTPReadiness(path string, status int) ReadinessCheck {
+	return HTTPPortReadiness("", path, status)
+}
+
+// HTTPPortReadiness is HTTPReadiness against another published container port.
+func HTTPPortReadiness(containerPort, path string, status int) ReadinessCheck {
+	return ReadinessFunc(func(ctx context.Context, app *App) (bool, error) {
+		request := app.Request(http.MethodGet, path).WithContext(ctx).WithoutRedirects()
+		if containerPort != "" {
+			request = request.OnPort(containerPort)
+		}
+
+		resp, err := request.Do()
+		if err != nil {
+			// The app is not accepting connections yet
+			return false, nil
+		}
+
+		if status == 0 {
+			return resp.StatusCode < 400, nil
+		}
+
+		return resp.StatusCode == status, nil
+	})
+}
+
+// tcpReadinessWait is how long TCPReadiness waits for a connection to be
+// closed by the other end before it counts it as accepted.
+const tcpReadinessWait = 250 * time.Millisecond
+
+// TCPReadiness is ready once the host port containerPort is published on
+// accepts a connection and keeps it open, or sends data on it. Docker's
+// userland proxy accepts connections even before the app listens, but then
+// closes them at once, so a connection that is closed straight away does not
+// count.
+func TCPReadiness(containerPort string) ReadinessCheck {
+	return ReadinessFunc(func(ctx context.Context, app *App) (bool, error) {
+		hostPort, err := app.HostPort(containerPort)
+		if err != nil {
+			return false, err
+		}
+
+		var dialer net.Dialer
+		conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort("localhost", hostPort))
+		if err != nil {
+			return false, nil
+		}
+		defer conn.Close()
+
+		err = conn.SetReadDeadline(time.Now().Add(tcpReadinessWait))
+		if err != nil {
+			return false, err
+		}
+
+		_, err = conn.Read(make([]byte, 1))
+		if err == nil {
+			return true, nil
+		}
+
+		if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+			return true, nil
+		}
+
+		return false, nil
+	})
+}
+
+// LogReadiness is ready once the app logs a line matching pattern.
+func LogReadiness(pattern *regexp.Regexp) ReadinessCheck {
+	return ReadinessFunc(func(ctx context.Context, app *App) (bool, error) {
+		follower, err := app.FollowLogs()
+		if err != nil {
+			return false, err
+		}
+
+		_, found := follower.Match(pattern)
+		return found, nil
+	})
+}
+
+// HealthCheck runs a HEALTHCHECK command inside the container and is ready
+// once the runtime reports the container healthy. The command defaults to
+// curl against $PORT, so it needs curl in the run image.
+type HealthCheck struct {
+	command  string
+	interval string
+	timeout  string
+}
+
+func DockerHealthCheck(command, interval, timeout string) HealthCheck {
+	return HealthCheck{
+		command:  command,
+		interval: interval,
+		timeout:  timeout,
+	}
+}
+
+func (h HealthCheck) configure(app *App, config *RunConfig) error {
+	command := h.command
+	if command == "" {
+		command = fmt.Sprintf("curl --fail http://localhost:%s || exit 1", app.Env["PORT"])
+	}
+
+	config.HealthCheck = &HealthConfig{
+		Test: []string{"CMD-SHELL", command},
+	}
+
+	var err error
+	if h.interval != "" {
+		config.HealthCheck.Interval, err = time.ParseDuration(h.interval)
+		if err != nil {
+			return fmt.Errorf("invalid health check interval: %s", err)
+		}
+	}
+
+	if h.timeout != "" {
+		config.HealthCheck.Timeout, err = time.ParseDuration(h.timeout)
+		if err != nil {
+			return fmt.Errorf("invalid health check timeout: %s", err)
+		}
+	}
+
+	return nil
+}
+
+func (h HealthCheck) Check(ctx context.Context, app *App) (bool, error) {
+	runtime, err := app.containerRuntime()
+	if err != nil {
+		return false, err
+	}
+
+	state, err := runtime.Inspect(ctx, app.ContainerID)
+	if err != nil {
+		return false, err
+	}
+
+	if state.Health == nil {
+		return false, fmt.Errorf("container %s reports no health status", app.ContainerID)
+	}
+
+	switch state.Health.Status {
+	case "healthy":
+		return true, nil
+	case "unhealthy":
+		return false, fmt.Errorf("app failed to start: %s", app.fixtureName)
+	default:
+		return false, nil
+	}
+}
@@ -0,0 +1,218 @@
+package dagger_test
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/cloudfoundry/dagger"
+	fakes "github.com/cloudfoundry/dagger/fakes/runtime"
+	"github.com/sclevine/spec"
+
+	. "github.com/onsi/gomega"
+)
+
+func testReadiness(t *testing.T, when spec.G, it spec.S) {
+	var (
+		app     dagger.App
+		runtime *fakes.ContainerRuntime
+		ctx     context.Context
+	)
+
+	// publish makes $PORT of the app reach the given listener address.
+	publish := func(address string) {
+		_, port, err := net.SplitHostPort(address)
+		Expect(err).NotTo(HaveOccurred())
+
+		runtime.PortMappings = []dagger.PortMapping{{ContainerPort: "8080/tcp", HostIP: "127.0.0.1", HostPort: port}}
+		Expect(app.StartWithContext(ctx, dagger.StartOptions{
+			Readiness: dagger.ReadinessFunc(func(context.Context, *dagger.App) (bool, error) {
+				return true, nil
+			}),
+			PollInterval: time.Millisecond,
+		})).To(Succeed())
+	}
+
+	it.Before(func() {
+		ctx = context.Background()
+		runtime = &fakes.ContainerRuntime{
+			ContainerID:  "app-id",
+			State:        dagger.ContainerState{Status: "running", Running: true},
+			PortMappings: []dagger.PortMapping{{ContainerPort: "8080/tcp", HostIP: "127.0.0.1", HostPort: "40000"}},
+		}
+
+		app = dagger.NewApp("some-fixture", "some-image", "some-cache", nil, nil)
+		app.SetContainerRuntime(runtime)
+	})
+
+	when("checking HTTP", func() {
+		var (
+			server *httptest.Server
+			status int
+		)
+
+		it.Before(func() {
+			status = http.StatusServiceUnavailable
+			server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				w.WriteHeader(status)
+			}))
+			publish(server.Listener.Addr().String())
+		})
+
+		it.After(func() {
+			server.Close()
+		})
+
+		it("is ready once the app responds without an error status", func() {
+			check := dagger.HTTPReadiness("/", 0)
+			Expect(check.Check(ctx, &app)).To(BeFalse())
+
+			status = http.StatusNotFound
+			Expect(check.Check(ctx, &app)).To(BeFalse())
+
+			status = http.StatusFound
+			Expect(check.Check(ctx, &app)).To(BeTrue())
+		})
+
+		it("is ready once the app responds with the given status", func() {
+			check := dagger.HTTPReadiness("/", http.StatusNoContent)
+			status = http.StatusOK
+			Expect(check.Check(ctx, &app)).To(BeFalse())
+
+			status = http.StatusNoContent
+			Expect(check.Check(ctx, &app)).To(BeTrue())
+		})
+	})
+
+	when("checking TCP", func() {
+		var listener net.Listener
+
+		it.Before(func() {
+			var err error
+			listener, err = net.Listen("tcp", "127.0.0.1:0")
+			Expect(err).NotTo(HaveOccurred())
+			publish(listener.Addr().String())
+		})
+
+		it.After(func() {
+			listener.Close()
+		})
+
+		// accept handles every connection to the listener with handle.
+		accept := func(handle func(net.Conn)) {
+			go func() {
+				for {
+					conn, err := listener.Accept()
+					if err != nil {
+						return
+					}
+					handle(conn)
+				}
+			}()
+		}
+
+		it("is ready once connections are kept open", func() {
+			accept(func(conn net.Conn) {
+				go func() {
+					time.Sleep(time.Second)
+					conn.Close()
+				}()
+			})
+
+			Expect(dagger.TCPReadiness("8080").Check(ctx, &app)).To(BeTrue())
+		})
+
+		it("is ready once connections are answered", func() {
+			accept(func(conn net.Conn) {
+				conn.Write([]byte("220 ready\r\n"))
+				conn.Close()
+			})
+
+			Expect(dagger.TCPReadiness("8080").Check(ctx, &app)).To(BeTrue())
+		})
+
+		it("is not ready while connections are closed straight away, like a proxy with nothing behind it does", func() {
+			accept(func(conn net.Conn) {
+				conn.Close()
+			})
+
+			Expect(dagger.TCPReadiness("8080").Check(ctx, &app)).To(BeFalse())
+		})
+
+		it("is not ready while nothing listens", func() {
+			listener.Close()
+			Expect(dagger.TCPReadiness("8080").Check(ctx, &app)).To(BeFalse())
+		})
+
+		it("fails for ports that are not published", func() {
+			_, err := dagger.TCPReadiness("9090").Check(ctx, &app)
+			Expect(err).To(MatchError(ContainSubstring("unable to get port map for container port 9090")))
+		})
+	})
+
+	when("checking logs", func() {
+		it("is ready once the app logs a matching line", func() {
+			runtime.ContainerLogs = "Booting...\nListening on 8080\n"
+			publish("127.0.0.1:40000")
+
+			Eventually(func() (bool, error) {
+				return dagger.LogReadiness(regexp.MustCompile(`Listening on \d+`)).Check(ctx, &app)
+			}).Should(BeTrue())
+			Expect(dagger.LogReadiness(regexp.MustCompile(`Error`)).Check(ctx, &app)).To(BeFalse())
+		})
+	})
+
+	when("using a docker health check", func() {
+		it("configures the health check of the container", func() {
+			runtime.State.Health = &dagger.Health{Status: "healthy"}
+			Expect(app.StartWithContext(ctx, dagger.StartOptions{
+				Readiness:    dagger.DockerHealthCheck("some-command", "5s", "2s"),
+				PollInterval: time.Millisecond,
+			})).To(Succeed())
+
+			Expect(runtime.Runs[0].HealthCheck).To(Equal(&dagger.HealthConfig{
+				Test:     []string{"CMD-SHELL", "some-command"},
+				Interval: 5 * time.Second,
+				Timeout:  2 * time.Second,
+			}))
+		})
+
+		it("defaults to curl against $PORT", func() {
+			runtime.State.Health = &dagger.Health{Status: "healthy"}
+			app.SetHealthCheck("", "", "")
+			Expect(app.StartWithContext(ctx, dagger.StartOptions{PollInterval: time.Millisecond})).To(Succeed())
+
+			Expect(runtime.Runs[0].HealthCheck).To(Equal(&dagger.HealthConfig{
+				Test: []string{"CMD-SHELL", "curl --fail http://localhost:8080 || exit 1"},
+			}))
+		})
+
+		it("rejects invalid durations before running the app", func() {
+			err := app.StartWithContext(ctx, dagger.StartOptions{Readiness: dagger.DockerHealthCheck("", "soon", "")})
+			Expect(err).To(MatchError(ContainSubstring("invalid health check interval")))
+			Expect(runtime.Runs).To(BeEmpty())
+		})
+
+		it("follows the health status of the container", func() {
+			check := dagger.DockerHealthCheck("", "", "")
+			app.ContainerID = "app-id"
+
+			_, err := check.Check(ctx, &app)
+			Expect(err).To(MatchError("container app-id reports no health status"))
+
+			runtime.State.Health = &dagger.Health{Status: "starting"}
+			Expect(check.Check(ctx, &app)).To(BeFalse())
+
+			runtime.State.Health.Status = "healthy"
+			Expect(check.Check(ctx, &app)).To(BeTrue())
+
+			runtime.State.Health.Status = "unhealthy"
+			_, err = check.Check(ctx, &app)
+			Expect(err).To(MatchError("app failed to start: some-fixture"))
+		})
+	})
+}
@@ -0,0 +1,84 @@
+package dagger
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+)
+
+var (
+	restoredLayerPattern = regexp.MustCompile(`Restoring (?:data for "([^"]+)" from cache|cached layer '([^']+)')`)
+	exportedLayerPattern = regexp.MustCompile(`(Reusing|Adding) (?:cache )?layer '([^']+)'`)
+)
+
+// RebuildResult lists what happened to the buildpack layers of an app during
+// a rebuild. Layers are named "<buildpack-id>:<layer>", as the lifecycle
+// prints them.
+type RebuildResult struct {
+	// Restored are the layers restored from the cache before building.
+	Restored []string
+
+	// Reused are the layers exported unchanged from the previous build.
+	Reused []string
+
+	// Rebuilt are the layers exported with new contents.
+	Rebuilt []string
+
+	BuildLogs string
+}
+
+// Rebuild runs pack build again with the image name and cache of the app,
+// applying options on top of those of the original build. The build logs of
+// the app are replaced by those of the rebuild. A running app container is
+// left running the previous image.
+func (a *App) Rebuild(options ...PackOption) (RebuildResult, error) {
+	if a.pack == nil {
+		return RebuildResult{}, errors.New("app was not built with pack and cannot be rebuilt")
+	}
+
+	pack := *a.pack
+	for _, option := range options {
+		pack = option(pack)
+	}
+	pack.image = a.pack.image
+
+	app, err := pack.Build()
+	if err != nil {
+		return RebuildResult{}, err
+	}
+
+	a.buildLogs = app.buildLogs
+	a.pack = app.pack
+
+	return parseRebuild(a.BuildLogs()), nil
+}
+
+func parseRebuild(logs string) RebuildResult {
+	result := RebuildResult{BuildLogs: logs}
+	seen := map[string]bool{}
+	add := func(list *[]string, kind, layer string) {
+		// Layers without a buildpack ID belong to the app or the launcher
+		if !strings.Contains(layer, ":") || seen[kind+layer] {
+			return
+		}
+
+		seen[kind+layer] = true
+		*list = append(*list, layer)
+	}
+
+	for _, line := range strings.Split(stripColor(logs), "\n") {
+		if match := restoredLayerPattern.FindStringSubmatch(line); match != nil {
+			add(&result.Restored, "restored", match[1]+match[2])
+		}
+
+		if match := exportedLayerPattern.FindStringSubmatch(line); match != nil {
+			if match[1] == "Reusing" {
+				add(&result.Reused, "reused", match[2])
+			} else {
+				add(&result.Rebuilt, "rebuilt", match[2])
+			}
+		}
+	}
+
+	return result
+}
@@ -0,0 +1,114 @@
+package dagger
+
+import (
+	"context"
+	"fmt"
+)
+
+// RegistryImage is the image LocalRegistry runs. It is never pulled, so it
+// must be pulled or loaded before starting the registry.
+const RegistryImage = "registry:2"
+
+// LocalRegistry is a registry container listening on a random localhost
+// port, which the docker daemon trusts without TLS.
+type LocalRegistry struct {
+	// Host is the address of the registry, such as "localhost:40123".
+	Host string
+
+	container *App
+}
+
+// StartLocalRegistry starts a registry from RegistryImage, which must already
+// be available, and waits for it to serve requests. A nil runtime uses the one
+// picked by NewContainerRuntime.
+func StartLocalRegistry(runtime ContainerRuntime) (*LocalRegistry, error) {
+	if runtime == nil {
+		var err error
+		runtime, err = NewContainerRuntime("")
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	ctx := context.Background()
+	exists, err := runtime.Exists(ctx, RegistryImage)
+	if err != nil {
+		return nil, err
+	}
+
+	if !exists {
+		return nil, fmt.Errorf("registry image %s is not available locally: pull or load it before starting the registry", RegistryImage)
+	}
+
+	container := &App{
+		ImageName:   RegistryImage,
+		fixtureName: "registry",
+		runtime:     runtime,
+	}
+
+	container.ContainerID, err = runtime.Run(ctx, RunConfig{
+		Image:  RegistryImage,
+		Ports:  []string{"5000"},
+		HostIP: "127.0.0.1",
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to run registry: %w", err)
+	}
+	registry := &LocalRegistry{container: container}
+
+	container.ports, err = runtime.Ports(ctx, container.ContainerID)
+	if err != nil {
+		registry.Stop()
+		return nil, fmt.Errorf("failed to get port of registry: %w", err)
+	}
+
+	port, err := container.HostPort("5000")
+	if err != nil {
+		registry.Stop()
+		return nil, err
+	}
+	registry.Host = fmt.Sprintf("localhost:%s", port)
+
+	err = container.waitUntilReady(ctx, runtime, HTTPPortReadiness("5000", "/v2/", 200), DefaultStartTimeout, DefaultStartPollInterval)
+	if err != nil {
+		registry.Stop()
+		return nil, err
+	}
+
+	return registry, nil
+}
+
+// Reference returns the reference of an image named name in the registry.
+func (r *LocalRegistry) Reference(name string) string {
+	return fmt.Sprintf("%s/%s", r.Host, name)
+}
+
+// Stop removes the registry container, along with every image pushed to it.
+func (r *LocalRegistry) Stop() error {
+	runtime, err := r.container.containerRuntime()
+	if err != nil {
+		return err
+	}
+
+	return runtime.Remove(context.Background(), r.container.ContainerID)
+}
+
+// SetPublish builds the image into registry with `pack build --publish`,
+// rather than into the daemon. Use App.Pull to run the published image.
+func SetPublish(registry *LocalRegistry) PackOption {
+	return func(pack Pack) Pack {
+		pack.registry = registry
+		return pack
+	}
+}
+
+// Pull pulls the app image into the daemon, which is needed to run or inspect
+// images published to a registry.
+func (a *App) Pull() error {
+	runtime, err := a.containerRuntime()
+	if err != nil {
+		return err
+	}
+
+	return runtime.PullImage(context.Background(), a.ImageName)
+}
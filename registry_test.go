@@ -0,0 +1,83 @@
+package dagger_test
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/cloudfoundry/dagger"
+	fakes "github.com/cloudfoundry/dagger/fakes/runtime"
+	"github.com/sclevine/spec"
+
+	. "github.com/onsi/gomega"
+)
+
+func testRegistry(t *testing.T, when spec.G, it spec.S) {
+	var (
+		server  *httptest.Server
+		port    string
+		runtime *fakes.ContainerRuntime
+	)
+
+	it.Before(func() {
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			if req.URL.Path != "/v2/" {
+				w.WriteHeader(http.StatusNotFound)
+			}
+		}))
+
+		var err error
+		_, port, err = net.SplitHostPort(server.Listener.Addr().String())
+		Expect(err).NotTo(HaveOccurred())
+
+		runtime = &fakes.ContainerRuntime{
+			ContainerID:  "registry-id",
+			State:        dagger.ContainerState{Status: "running", Running: true},
+			PortMappings: []dagger.PortMapping{{ContainerPort: "5000/tcp", HostIP: "127.0.0.1", HostPort: port}},
+			Existing:     []string{"registry:2"},
+		}
+	})
+
+	it.After(func() {
+		server.Close()
+	})
+
+	it("publishes builds to a registry on localhost and pulls them back", func() {
+		registry, err := dagger.StartLocalRegistry(runtime)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(registry.Host).To(Equal("localhost:" + port))
+		Expect(runtime.Pulled).To(BeEmpty())
+		Expect(runtime.Runs[0].Ports).To(Equal([]string{"5000"}))
+		Expect(runtime.Runs[0].HostIP).To(Equal("127.0.0.1"))
+
+		tmpDir, err := filepath.EvalSymlinks(os.TempDir())
+		Expect(err).NotTo(HaveOccurred())
+
+		app, err := dagger.NewPack(tmpDir,
+			dagger.SetImage("test-pack-image"),
+			dagger.SetPublish(registry),
+			dagger.SetContainerRuntime(runtime),
+		).Build()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(app.ImageName).To(Equal(registry.Reference("test-pack-image")))
+		Expect(app.BuildLogs()).To(ContainSubstring("pack build " + registry.Host + "/test-pack-image --builder cloudfoundry/cnb:cflinuxfs3 --publish]"))
+
+		Expect(app.Pull()).To(Succeed())
+		Expect(runtime.Pulled).To(Equal([]string{registry.Host + "/test-pack-image"}))
+
+		Expect(registry.Stop()).To(Succeed())
+		Expect(runtime.Removed).To(Equal([]string{"registry-id"}))
+	})
+
+	it("does not pull the registry image", func() {
+		runtime.Existing = nil
+
+		_, err := dagger.StartLocalRegistry(runtime)
+		Expect(err).To(MatchError("registry image registry:2 is not available locally: pull or load it before starting the registry"))
+		Expect(runtime.Pulled).To(BeEmpty())
+		Expect(runtime.Runs).To(BeEmpty())
+	})
+}
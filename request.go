@@ -0,0 +1,157 @@
+package dagger
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+// Request builds an HTTP request against a running App.
+type Request struct {
+	app             *App
+	method          string
+	path            string
+	port            string
+	header          http.Header
+	body            io.Reader
+	followRedirects bool
+	timeout         time.Duration
+	ctx             context.Context
+	err             error
+}
+
+// Response is the outcome of a Request. Non-2xx responses are returned as
+// they are rather than as errors.
+type Response struct {
+	StatusCode int
+	Header     http.Header
+	Body       string
+}
+
+// BadResponseError is returned by HTTPGet when the app does not respond with
+// a 2xx status code.
+type BadResponseError struct {
+	Response Response
+}
+
+func (e *BadResponseError) Error() string {
+	return fmt.Sprintf("received bad response from application: status %d: %s", e.Response.StatusCode, e.Response.Body)
+}
+
+// Request starts building a request for path on the app's $PORT.
+func (a *App) Request(method, path string) *Request {
+	return &Request{
+		app:             a,
+		method:          method,
+		path:            path,
+		header:          http.Header{},
+		followRedirects: true,
+		ctx:             context.Background(),
+	}
+}
+
+// OnPort sends the request to another container port published through
+// StartOptions.Ports.
+func (r *Request) OnPort(containerPort string) *Request {
+	r.port = containerPort
+	return r
+}
+
+func (r *Request) WithHeader(key, value string) *Request {
+	r.header.Add(key, value)
+	return r
+}
+
+func (r *Request) WithBody(body io.Reader) *Request {
+	r.body = body
+	return r
+}
+
+// WithJSON encodes value as the request body and sets the content type.
+func (r *Request) WithJSON(value interface{}) *Request {
+	content, err := json.Marshal(value)
+	if err != nil {
+		r.err = fmt.Errorf("failed to encode request body: %w", err)
+		return r
+	}
+
+	r.header.Set("Content-Type", "application/json")
+	r.body = bytes.NewReader(content)
+	return r
+}
+
+// WithoutRedirects returns redirect responses instead of following them.
+func (r *Request) WithoutRedirects() *Request {
+	r.followRedirects = false
+	return r
+}
+
+func (r *Request) WithContext(ctx context.Context) *Request {
+	r.ctx = ctx
+	return r
+}
+
+func (r *Request) WithTimeout(timeout time.Duration) *Request {
+	r.timeout = timeout
+	return r
+}
+
+func (r *Request) Do() (Response, error) {
+	if r.err != nil {
+		return Response{}, r.err
+	}
+
+	baseURL := r.app.GetBaseURL()
+	if r.port != "" {
+		var err error
+		baseURL, err = r.app.URLFor(r.port)
+		if err != nil {
+			return Response{}, err
+		}
+	}
+
+	req, err := http.NewRequestWithContext(r.ctx, r.method, fmt.Sprintf("%s%s", baseURL, r.path), r.body)
+	if err != nil {
+		return Response{}, err
+	}
+
+	for key, values := range r.header {
+		for _, value := range values {
+			req.Header.Add(key, value)
+		}
+	}
+
+	// net/http ignores a Host entry in the header map
+	if host := r.header.Get("Host"); host != "" {
+		req.Host = host
+	}
+
+	client := &http.Client{Timeout: r.timeout}
+	if !r.followRedirects {
+		client.CheckRedirect = func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		}
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return Response{}, err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return Response{}, err
+	}
+
+	return Response{
+		StatusCode: resp.StatusCode,
+		Header:     resp.Header,
+		Body:       string(body),
+	}, nil
+}
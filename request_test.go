@@ -0,0 +1,157 @@
+package dagger_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cloudfoundry/dagger"
+	fakes "github.com/cloudfoundry/dagger/fakes/runtime"
+	"github.com/sclevine/spec"
+
+	. "github.com/onsi/gomega"
+)
+
+func testRequest(t *testing.T, when spec.G, it spec.S) {
+	var (
+		app    dagger.App
+		server *httptest.Server
+	)
+
+	it.Before(func() {
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			switch req.URL.Path {
+			case "/redirect":
+				http.Redirect(w, req, "/echo", http.StatusFound)
+			case "/missing":
+				http.NotFound(w, req)
+			case "/broken":
+				w.WriteHeader(http.StatusInternalServerError)
+				fmt.Fprint(w, "something broke")
+			default:
+				body, err := ioutil.ReadAll(req.Body)
+				Expect(err).NotTo(HaveOccurred())
+
+				w.Header().Set("X-Method", req.Method)
+				w.Header().Set("X-Host", req.Host)
+				w.Header().Set("X-Content-Type", req.Header.Get("Content-Type"))
+				w.Header().Set("X-Some-Header", req.Header.Get("Some-Header"))
+				fmt.Fprintf(w, "%s %s", req.URL.Path, body)
+			}
+		}))
+
+		_, port, err := net.SplitHostPort(server.Listener.Addr().String())
+		Expect(err).NotTo(HaveOccurred())
+
+		runtime := &fakes.ContainerRuntime{
+			ContainerID: "app-id",
+			State:       dagger.ContainerState{Status: "running", Running: true},
+			PortMappings: []dagger.PortMapping{
+				{ContainerPort: "8080/tcp", HostIP: "127.0.0.1", HostPort: port},
+				{ContainerPort: "9090/tcp", HostIP: "127.0.0.1", HostPort: port},
+			},
+		}
+
+		app = dagger.NewApp("some-fixture", "some-image", "some-cache", nil, nil)
+		app.SetContainerRuntime(runtime)
+		Expect(app.StartWithContext(context.Background(), dagger.StartOptions{
+			Ports: []string{"9090"},
+			Readiness: dagger.ReadinessFunc(func(context.Context, *dagger.App) (bool, error) {
+				return true, nil
+			}),
+			PollInterval: time.Millisecond,
+		})).To(Succeed())
+	})
+
+	it.After(func() {
+		server.Close()
+	})
+
+	it("sends requests with any method, headers and body", func() {
+		resp, err := app.Request(http.MethodPut, "/echo").
+			WithHeader("Some-Header", "some-value").
+			WithBody(strings.NewReader("some-body")).
+			Do()
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+		Expect(resp.Header.Get("X-Method")).To(Equal("PUT"))
+		Expect(resp.Header.Get("X-Some-Header")).To(Equal("some-value"))
+		Expect(resp.Body).To(Equal("/echo some-body"))
+	})
+
+	it("encodes JSON bodies", func() {
+		resp, err := app.Request(http.MethodPost, "/echo").WithJSON(map[string]string{"key": "value"}).Do()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resp.Header.Get("X-Content-Type")).To(Equal("application/json"))
+		Expect(resp.Body).To(Equal(`/echo {"key":"value"}`))
+
+		_, err = app.Request(http.MethodPost, "/echo").WithJSON(make(chan int)).Do()
+		Expect(err).To(MatchError(ContainSubstring("failed to encode request body")))
+	})
+
+	it("overrides the Host header", func() {
+		resp, err := app.Request(http.MethodGet, "/echo").WithHeader("Host", "example.com").Do()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resp.Header.Get("X-Host")).To(Equal("example.com"))
+	})
+
+	it("follows redirects unless told not to", func() {
+		resp, err := app.Request(http.MethodGet, "/redirect").Do()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+		Expect(resp.Body).To(Equal("/echo "))
+
+		resp, err = app.Request(http.MethodGet, "/redirect").WithoutRedirects().Do()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resp.StatusCode).To(Equal(http.StatusFound))
+		Expect(resp.Header.Get("Location")).To(Equal("/echo"))
+	})
+
+	it("returns error responses rather than errors", func() {
+		resp, err := app.Request(http.MethodGet, "/missing").Do()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resp.StatusCode).To(Equal(http.StatusNotFound))
+
+		resp, err = app.Request(http.MethodGet, "/broken").Do()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resp.StatusCode).To(Equal(http.StatusInternalServerError))
+		Expect(resp.Body).To(Equal("something broke"))
+	})
+
+	it("sends requests to other published ports", func() {
+		resp, err := app.Request(http.MethodGet, "/echo").OnPort("9090").Do()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+
+		_, err = app.Request(http.MethodGet, "/echo").OnPort("7070").Do()
+		Expect(err).To(MatchError(ContainSubstring("unable to get port map for container port 7070")))
+	})
+
+	when("using HTTPGet", func() {
+		it("returns the body and headers of 2xx responses", func() {
+			body, header, err := app.HTTPGet("/echo")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(body).To(Equal("/echo "))
+			Expect(header).To(HaveKeyWithValue("X-Method", []string{"GET"}))
+
+			Expect(app.HTTPGetBody("/echo")).To(Equal("/echo "))
+		})
+
+		it("returns other responses as a BadResponseError", func() {
+			_, _, err := app.HTTPGet("/broken")
+			Expect(err).To(MatchError("received bad response from application: status 500: something broke"))
+
+			var badResponse *dagger.BadResponseError
+			Expect(errors.As(err, &badResponse)).To(BeTrue())
+			Expect(badResponse.Response.StatusCode).To(Equal(http.StatusInternalServerError))
+		})
+	})
+}
@@ -0,0 +1,93 @@
+package dagger
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// RunOptions are the resource limits and security settings of the app
+// container.
+type RunOptions struct {
+	// CPUs limits the container to a number of CPUs, such as 1.5.
+	CPUs float64
+
+	// PidsLimit limits the number of processes in the container.
+	PidsLimit int64
+
+	// ReadOnly mounts the root filesystem of the container read-only.
+	ReadOnly bool
+
+	// Tmpfs mounts a tmpfs at each path, with mount options such as
+	// "rw,size=64m" or none.
+	Tmpfs map[string]string
+
+	// User runs the container as a user other than the one of the image,
+	// such as "1000:1000".
+	User string
+
+	CapAdd  []string
+	CapDrop []string
+
+	Ulimits []Ulimit
+}
+
+// Ulimit is a resource limit of the container, such as "nofile".
+type Ulimit struct {
+	Name string `json:"Name"`
+	Soft int64  `json:"Soft"`
+	Hard int64  `json:"Hard"`
+}
+
+// Validate checks the options for invalid and conflicting values, so they
+// fail before a container is created.
+func (o RunOptions) Validate() error {
+	if o.CPUs < 0 {
+		return fmt.Errorf("invalid CPUs %g: must not be negative", o.CPUs)
+	}
+
+	if o.PidsLimit < 0 {
+		return fmt.Errorf("invalid pids limit %d: must not be negative", o.PidsLimit)
+	}
+
+	for mountPath := range o.Tmpfs {
+		if !path.IsAbs(mountPath) {
+			return fmt.Errorf("invalid tmpfs mount %s: must be an absolute path", mountPath)
+		}
+	}
+
+	dropped := map[string]bool{}
+	for _, capability := range o.CapDrop {
+		dropped[normalizeCapability(capability)] = true
+	}
+
+	for _, capability := range o.CapAdd {
+		if normalizeCapability(capability) != "ALL" && dropped[normalizeCapability(capability)] {
+			return fmt.Errorf("capability %s is both added and dropped", capability)
+		}
+	}
+
+	names := map[string]bool{}
+	for _, ulimit := range o.Ulimits {
+		if ulimit.Name == "" {
+			return fmt.Errorf("invalid ulimit: missing name")
+		}
+
+		if names[ulimit.Name] {
+			return fmt.Errorf("ulimit %s is set more than once", ulimit.Name)
+		}
+		names[ulimit.Name] = true
+
+		if ulimit.Hard >= 0 && ulimit.Soft > ulimit.Hard {
+			return fmt.Errorf("invalid ulimit %s: soft limit %d exceeds hard limit %d", ulimit.Name, ulimit.Soft, ulimit.Hard)
+		}
+	}
+
+	return nil
+}
+
+// normalizeCapability accepts capabilities with or without the CAP_ prefix,
+// as docker does.
+func normalizeCapability(capability string) string {
+	return strings.TrimPrefix(strings.ToUpper(capability), "CAP_")
+}
@@ -0,0 +1,378 @@
+package dagger
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ContainerRuntimeEnv names the environment variable used to pick the
+// container runtime ("docker" or "podman") when none is set explicitly.
+const ContainerRuntimeEnv = "DAGGER_CONTAINER_RUNTIME"
+
+// ContainerRuntime is the set of container operations an App relies on.
+type ContainerRuntime interface {
+	Run(ctx context.Context, config RunConfig) (string, error)
+	Create(ctx context.Context, config RunConfig) (string, error)
+	ContainersFrom(ctx context.Context, image string, since time.Time) ([]ContainerSummary, error)
+	Inspect(ctx context.Context, id string) (ContainerState, error)
+	Logs(ctx context.Context, id string) (string, error)
+	FollowLogs(ctx context.Context, id string) (io.ReadCloser, error)
+	Exec(ctx context.Context, id string, cmd []string, options ExecOptions) (ExecResult, error)
+	CopyFrom(ctx context.Context, id, path string) (io.ReadCloser, error)
+	Stop(ctx context.Context, id string) error
+	Remove(ctx context.Context, id string) error
+	Ports(ctx context.Context, id string) ([]PortMapping, error)
+	Exists(ctx context.Context, name string) (bool, error)
+	InspectImage(ctx context.Context, name string) (ImageJSON, error)
+	SaveImage(ctx context.Context, name string) (io.ReadCloser, error)
+	PullImage(ctx context.Context, name string) error
+	RemoveImage(ctx context.Context, name string) error
+	RemoveVolume(ctx context.Context, name string) error
+	Volumes(ctx context.Context) ([]string, error)
+	PruneImages(ctx context.Context) error
+	CreateNetwork(ctx context.Context, name string) error
+	RemoveNetwork(ctx context.Context, name string) error
+}
+
+// RunConfig describes a container to be started in the background.
+type RunConfig struct {
+	Image   string
+	Command []string
+	Env     map[string]string
+
+	// Ports are container ports, such as "8080", published on random host ports.
+	Ports []string
+
+	// HostIP restricts the published ports to one host address, such as
+	// "127.0.0.1".
+	HostIP string
+
+	// Memory is a docker style memory limit, such as "512m".
+	Memory string
+
+	HealthCheck *HealthConfig
+
+	Options RunOptions
+
+	// Network is a user-defined network to attach the container to, where
+	// other containers reach it by any of its NetworkAliases.
+	Network        string
+	NetworkAliases []string
+
+	Mounts []Mount
+}
+
+// PortMapping is a container port published on the host.
+type PortMapping struct {
+	ContainerPort string
+	HostIP        string
+	HostPort      string
+}
+
+// NewContainerRuntime returns the runtime called name. An empty name falls
+// back to $DAGGER_CONTAINER_RUNTIME and then to docker.
+func NewContainerRuntime(name string) (ContainerRuntime, error) {
+	if name == "" {
+		name = os.Getenv(ContainerRuntimeEnv)
+	}
+
+	switch name {
+	case "", "docker":
+		client, err := NewDockerClient("")
+		if err != nil {
+			return nil, err
+		}
+
+		return NewDockerRuntime(client), nil
+	case "podman":
+		return NewPodmanRuntime(), nil
+	default:
+		return nil, fmt.Errorf("unsupported container runtime %q: please use either 'docker' or 'podman'", name)
+	}
+}
+
+// DockerRuntime runs containers through the Docker Engine API.
+type DockerRuntime struct {
+	client *DockerClient
+}
+
+func NewDockerRuntime(client *DockerClient) DockerRuntime {
+	return DockerRuntime{
+		client: client,
+	}
+}
+
+func (d DockerRuntime) Run(ctx context.Context, config RunConfig) (string, error) {
+	id, err := d.Create(ctx, config)
+	if err != nil {
+		return "", err
+	}
+
+	err = d.client.ContainerStart(ctx, id)
+	if err != nil {
+		// The id is not returned, so nothing else could remove the container
+		removeErr := d.client.ContainerRemove(context.Background(), id)
+		if removeErr != nil {
+			return "", fmt.Errorf("%w; %s", err, removeErr)
+		}
+
+		return "", err
+	}
+
+	return id, nil
+}
+
+// Create creates a container without starting it.
+func (d DockerRuntime) Create(ctx context.Context, config RunConfig) (string, error) {
+	var memory int64
+	if config.Memory != "" {
+		var err error
+		memory, err = parseMemory(config.Memory)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	containerConfig := ContainerConfig{
+		Image:       config.Image,
+		Cmd:         config.Command,
+		Env:         envList(config.Env),
+		User:        config.Options.User,
+		Healthcheck: config.HealthCheck,
+		HostConfig: HostConfig{
+			Memory:         memory,
+			NanoCPUs:       int64(config.Options.CPUs * 1e9),
+			PidsLimit:      config.Options.PidsLimit,
+			ReadonlyRootfs: config.Options.ReadOnly,
+			Tmpfs:          config.Options.Tmpfs,
+			CapAdd:         config.Options.CapAdd,
+			CapDrop:        config.Options.CapDrop,
+			Ulimits:        config.Options.Ulimits,
+			Mounts:         config.Mounts,
+		},
+	}
+
+	if config.Network != "" {
+		containerConfig.HostConfig.NetworkMode = config.Network
+		containerConfig.NetworkingConfig = &NetworkingConfig{
+			EndpointsConfig: map[string]EndpointSettings{
+				config.Network: {Aliases: config.NetworkAliases},
+			},
+		}
+	}
+
+	if len(config.Ports) > 0 {
+		containerConfig.ExposedPorts = map[string]struct{}{}
+		containerConfig.HostConfig.PortBindings = map[string][]PortBinding{}
+		containerConfig.HostConfig.PublishAllPorts = config.HostIP == ""
+		for _, port := range config.Ports {
+			containerConfig.ExposedPorts[tcpPort(port)] = struct{}{}
+			containerConfig.HostConfig.PortBindings[tcpPort(port)] = []PortBinding{{HostIP: config.HostIP}}
+		}
+	}
+
+	id, err := d.client.ContainerCreate(ctx, containerConfig)
+	if err != nil {
+		return "", err
+	}
+
+	return shortID(id), nil
+}
+
+// ContainersFrom lists the containers created from image, or from images
+// built on it, since a point in time.
+func (d DockerRuntime) ContainersFrom(ctx context.Context, image string, since time.Time) ([]ContainerSummary, error) {
+	containers, err := d.client.ContainerList(ctx, map[string][]string{"ancestor": {image}})
+	if err != nil {
+		return nil, err
+	}
+
+	var summaries []ContainerSummary
+	for _, container := range containers {
+		if container.Created >= since.Unix() {
+			container.ID = shortID(container.ID)
+			summaries = append(summaries, container)
+		}
+	}
+
+	return summaries, nil
+}
+
+func (d DockerRuntime) Inspect(ctx context.Context, id string) (ContainerState, error) {
+	container, err := d.client.ContainerInspect(ctx, id)
+	if err != nil {
+		return ContainerState{}, err
+	}
+
+	return container.State, nil
+}
+
+func (d DockerRuntime) Logs(ctx context.Context, id string) (string, error) {
+	logs, err := d.client.ContainerLogs(ctx, id, false)
+	if err != nil {
+		return "", err
+	}
+	defer logs.Close()
+
+	buffer := bytes.NewBuffer(nil)
+	_, err = io.Copy(buffer, logs)
+	if err != nil {
+		return "", err
+	}
+
+	return buffer.String(), nil
+}
+
+func (d DockerRuntime) FollowLogs(ctx context.Context, id string) (io.ReadCloser, error) {
+	return d.client.ContainerLogs(ctx, id, true)
+}
+
+func (d DockerRuntime) Exec(ctx context.Context, id string, cmd []string, options ExecOptions) (ExecResult, error) {
+	execID, err := d.client.ExecCreate(ctx, id, ExecConfig{
+		Cmd:          cmd,
+		Env:          envList(options.Env),
+		User:         options.User,
+		WorkingDir:   options.WorkingDir,
+		AttachStdout: true,
+		AttachStderr: true,
+	})
+	if err != nil {
+		return ExecResult{}, err
+	}
+
+	stdout := bytes.NewBuffer(nil)
+	stderr := bytes.NewBuffer(nil)
+	err = d.client.ExecStart(ctx, execID, stdout, stderr)
+	if err != nil {
+		return ExecResult{Stdout: stdout.String(), Stderr: stderr.String()}, err
+	}
+
+	inspect, err := d.client.ExecInspect(ctx, execID)
+	if err != nil {
+		return ExecResult{Stdout: stdout.String(), Stderr: stderr.String()}, err
+	}
+
+	return ExecResult{
+		Stdout:   stdout.String(),
+		Stderr:   stderr.String(),
+		ExitCode: inspect.ExitCode,
+	}, nil
+}
+
+func (d DockerRuntime) CopyFrom(ctx context.Context, id, path string) (io.ReadCloser, error) {
+	return d.client.ContainerArchive(ctx, id, path)
+}
+
+func (d DockerRuntime) Stop(ctx context.Context, id string) error {
+	return d.client.ContainerStop(ctx, id)
+}
+
+func (d DockerRuntime) Remove(ctx context.Context, id string) error {
+	return d.client.ContainerRemove(ctx, id)
+}
+
+func (d DockerRuntime) Ports(ctx context.Context, id string) ([]PortMapping, error) {
+	container, err := d.client.ContainerInspect(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	var containerPorts []string
+	for port := range container.NetworkSettings.Ports {
+		containerPorts = append(containerPorts, port)
+	}
+	sort.Strings(containerPorts)
+
+	var mappings []PortMapping
+	for _, port := range containerPorts {
+		for _, binding := range container.NetworkSettings.Ports[port] {
+			mappings = append(mappings, PortMapping{
+				ContainerPort: port,
+				HostIP:        binding.HostIP,
+				HostPort:      binding.HostPort,
+			})
+		}
+	}
+
+	return mappings, nil
+}
+
+func (d DockerRuntime) Exists(ctx context.Context, name string) (bool, error) {
+	return d.client.Exists(ctx, name)
+}
+
+func (d DockerRuntime) InspectImage(ctx context.Context, name string) (ImageJSON, error) {
+	return d.client.ImageInspect(ctx, name)
+}
+
+func (d DockerRuntime) SaveImage(ctx context.Context, name string) (io.ReadCloser, error) {
+	return d.client.ImageSave(ctx, name)
+}
+
+func (d DockerRuntime) PullImage(ctx context.Context, name string) error {
+	return d.client.ImagePull(ctx, name)
+}
+
+func (d DockerRuntime) RemoveImage(ctx context.Context, name string) error {
+	return d.client.ImageRemove(ctx, name)
+}
+
+func (d DockerRuntime) RemoveVolume(ctx context.Context, name string) error {
+	return d.client.VolumeRemove(ctx, name)
+}
+
+func (d DockerRuntime) Volumes(ctx context.Context) ([]string, error) {
+	volumes, err := d.client.VolumeList(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, volume := range volumes {
+		names = append(names, volume.Name)
+	}
+
+	return names, nil
+}
+
+func (d DockerRuntime) PruneImages(ctx context.Context) error {
+	return d.client.ImagesPrune(ctx)
+}
+
+func (d DockerRuntime) CreateNetwork(ctx context.Context, name string) error {
+	_, err := d.client.NetworkCreate(ctx, name)
+	return err
+}
+
+func (d DockerRuntime) RemoveNetwork(ctx context.Context, name string) error {
+	return d.client.NetworkRemove(ctx, name)
+}
+
+func envList(env map[string]string) []string {
+	var keys []string
+	for key := range env {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var list []string
+	for _, key := range keys {
+		list = append(list, fmt.Sprintf("%s=%s", key, env[key]))
+	}
+
+	return list
+}
+
+func tcpPort(port string) string {
+	if strings.Contains(port, "/") {
+		return port
+	}
+
+	return fmt.Sprintf("%s/tcp", port)
+}
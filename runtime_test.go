@@ -0,0 +1,198 @@
+package dagger_test
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/cloudfoundry/dagger"
+	fakes "github.com/cloudfoundry/dagger/fakes/runtime"
+	"github.com/sclevine/spec"
+
+	. "github.com/onsi/gomega"
+)
+
+func testContainerRuntime(t *testing.T, when spec.G, it spec.S) {
+	when("selecting a container runtime", func() {
+		var existingRuntime string
+
+		it.Before(func() {
+			existingRuntime = os.Getenv(dagger.ContainerRuntimeEnv)
+		})
+
+		it.After(func() {
+			Expect(os.Setenv(dagger.ContainerRuntimeEnv, existingRuntime)).To(Succeed())
+		})
+
+		it("defaults to docker", func() {
+			Expect(os.Unsetenv(dagger.ContainerRuntimeEnv)).To(Succeed())
+
+			runtime, err := dagger.NewContainerRuntime("")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(runtime).To(BeAssignableToTypeOf(dagger.DockerRuntime{}))
+		})
+
+		it("uses the runtime named by the environment", func() {
+			Expect(os.Setenv(dagger.ContainerRuntimeEnv, "podman")).To(Succeed())
+
+			runtime, err := dagger.NewContainerRuntime("")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(runtime).To(BeAssignableToTypeOf(dagger.PodmanRuntime{}))
+		})
+
+		it("prefers an explicit runtime over the environment", func() {
+			Expect(os.Setenv(dagger.ContainerRuntimeEnv, "podman")).To(Succeed())
+
+			runtime, err := dagger.NewContainerRuntime("docker")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(runtime).To(BeAssignableToTypeOf(dagger.DockerRuntime{}))
+		})
+
+		it("rejects unknown runtimes", func() {
+			_, err := dagger.NewContainerRuntime("nerdctl")
+			Expect(err).To(MatchError(ContainSubstring("unsupported container runtime \"nerdctl\"")))
+		})
+	})
+
+	when("validating run options", func() {
+		it("accepts dropping all capabilities and adding some back", func() {
+			Expect(dagger.RunOptions{
+				CapDrop: []string{"ALL"},
+				CapAdd:  []string{"ALL", "NET_BIND_SERVICE"},
+			}.Validate()).To(Succeed())
+		})
+
+		it("rejects conflicting and invalid values", func() {
+			Expect(dagger.RunOptions{CPUs: -1}.Validate()).To(MatchError("invalid CPUs -1: must not be negative"))
+			Expect(dagger.RunOptions{Tmpfs: map[string]string{"tmp": ""}}.Validate()).To(MatchError("invalid tmpfs mount tmp: must be an absolute path"))
+			Expect(dagger.RunOptions{
+				CapDrop: []string{"net_raw"},
+				CapAdd:  []string{"CAP_NET_RAW"},
+			}.Validate()).To(MatchError("capability CAP_NET_RAW is both added and dropped"))
+			Expect(dagger.RunOptions{
+				Ulimits: []dagger.Ulimit{{Name: "nofile", Soft: 2048, Hard: 1024}},
+			}.Validate()).To(MatchError("invalid ulimit nofile: soft limit 2048 exceeds hard limit 1024"))
+		})
+
+		it("fails to start an app before creating a container", func() {
+			app := dagger.NewApp("some-fixture", "some-image", "some-cache", nil, nil)
+			app.SetContainerRuntime(&fakes.ContainerRuntime{})
+			app.RunOptions.PidsLimit = -1
+
+			Expect(app.Start()).To(MatchError("invalid pids limit -1: must not be negative"))
+		})
+	})
+
+	when("starting an app with mounts", func() {
+		var (
+			app     dagger.App
+			runtime *fakes.ContainerRuntime
+		)
+
+		it.Before(func() {
+			runtime = newServiceRuntime()
+			app = dagger.NewApp("some-fixture", "some-image", "some-cache", nil, nil)
+			app.SetContainerRuntime(runtime)
+		})
+
+		it("mounts them and removes the volumes it created", func() {
+			err := app.StartWithContext(context.Background(), dagger.StartOptions{
+				Mounts: []dagger.Mount{
+					{Type: dagger.MountTypeBind, Source: "fixtures", Target: "/config", ReadOnly: true},
+					{Type: dagger.MountTypeVolume, Source: "existing-volume", Target: "/data"},
+					{Type: dagger.MountTypeVolume, Target: "/scratch"},
+					{Type: dagger.MountTypeTmpfs, Target: "/tmp"},
+				},
+				Readiness: dagger.ReadinessFunc(func(context.Context, *dagger.App) (bool, error) {
+					return true, nil
+				}),
+				PollInterval: time.Millisecond,
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			wd, err := os.Getwd()
+			Expect(err).NotTo(HaveOccurred())
+
+			mounts := runtime.Runs[0].Mounts
+			Expect(mounts).To(HaveLen(4))
+			Expect(mounts[0]).To(Equal(dagger.Mount{Type: "bind", Source: filepath.Join(wd, "fixtures"), Target: "/config", ReadOnly: true}))
+			Expect(mounts[2].Source).To(HavePrefix("dagger-"))
+
+			Expect(app.Destroy()).To(Succeed())
+			Expect(runtime.Removed).To(Equal([]string{"app-id"}))
+			Expect(runtime.RemovedVolumes).To(Equal([]string{mounts[2].Source}))
+		})
+
+		it("mounts bindings and removes them on destroy", func() {
+			err := app.StartWithContext(context.Background(), dagger.StartOptions{
+				Bindings: []dagger.Binding{{Name: "some-db", Type: "postgresql", Entries: map[string]string{"password": "secret"}}},
+				Readiness: dagger.ReadinessFunc(func(context.Context, *dagger.App) (bool, error) {
+					return true, nil
+				}),
+				PollInterval: time.Millisecond,
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			config := runtime.Runs[0]
+			Expect(config.Env).To(HaveKeyWithValue("SERVICE_BINDING_ROOT", "/platform/bindings"))
+			Expect(config.Mounts).To(HaveLen(1))
+			Expect(config.Mounts[0].Target).To(Equal("/platform/bindings"))
+			Expect(config.Mounts[0].ReadOnly).To(BeTrue())
+
+			bindingsDir := config.Mounts[0].Source
+			Expect(ioutil.ReadFile(filepath.Join(bindingsDir, "some-db", "type"))).To(Equal([]byte("postgresql")))
+			Expect(ioutil.ReadFile(filepath.Join(bindingsDir, "some-db", "password"))).To(Equal([]byte("secret")))
+
+			Expect(app.Destroy()).To(Succeed())
+			Expect(bindingsDir).NotTo(BeADirectory())
+		})
+
+		it("rejects invalid mounts before running the app", func() {
+			err := app.StartWithContext(context.Background(), dagger.StartOptions{
+				Mounts: []dagger.Mount{{Type: dagger.MountTypeTmpfs, Source: "some-source", Target: "/tmp"}},
+			})
+			Expect(err).To(MatchError("tmpfs mount at /tmp cannot have a source"))
+			Expect(runtime.Runs).To(BeEmpty())
+		})
+
+		it("rejects mounts that share a target before running the app", func() {
+			err := app.StartWithContext(context.Background(), dagger.StartOptions{
+				Mounts: []dagger.Mount{
+					{Type: dagger.MountTypeVolume, Target: "/data"},
+					{Type: dagger.MountTypeBind, Source: "fixtures", Target: "/data/"},
+				},
+			})
+			Expect(err).To(MatchError("bind mount at /data/ conflicts with another mount at the same target"))
+
+			app.RunOptions.Tmpfs = map[string]string{"/tmp": "size=64m"}
+			err = app.StartWithContext(context.Background(), dagger.StartOptions{
+				Mounts: []dagger.Mount{{Type: dagger.MountTypeTmpfs, Target: "/tmp"}},
+			})
+			Expect(err).To(MatchError("tmpfs mount at /tmp conflicts with another mount at the same target"))
+			Expect(runtime.Runs).To(BeEmpty())
+		})
+
+		it("removes the volumes it created when the app fails to run", func() {
+			runtime.RunStub = func(context.Context, dagger.RunConfig) (string, error) {
+				return "", errors.New("failed to start")
+			}
+
+			err := app.StartWithContext(context.Background(), dagger.StartOptions{
+				Mounts: []dagger.Mount{
+					{Type: dagger.MountTypeVolume, Source: "existing-volume", Target: "/data"},
+					{Type: dagger.MountTypeVolume, Target: "/scratch"},
+				},
+			})
+			Expect(err).To(MatchError(ContainSubstring("failed to start")))
+			Expect(runtime.RemovedVolumes).To(Equal([]string{runtime.Runs[0].Mounts[1].Source}))
+
+			runtime.RemovedVolumes = nil
+			Expect(app.Destroy()).To(Succeed())
+			Expect(runtime.RemovedVolumes).To(BeEmpty())
+		})
+	})
+}
@@ -0,0 +1,188 @@
+package dagger
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/cloudfoundry/dagger/utils"
+)
+
+var envNamePattern = regexp.MustCompile(`[^A-Z0-9]+`)
+
+// Service is a companion container, such as a database or a cache, that the
+// app reaches by Name over a network private to the app.
+type Service struct {
+	// Name is the hostname of the service on the app network.
+	Name string
+
+	// Image is a local image to run the service from.
+	Image   string
+	Command []string
+	Env     map[string]string
+
+	// Port is the container port the service listens on, such as "5432". It
+	// is also published on a random host port.
+	Port string
+
+	// AppEnv is added to the environment of the app, next to the
+	// <NAME>_HOST and <NAME>_PORT variables set for every service.
+	AppEnv map[string]string
+
+	// Readiness decides when the service is ready. Defaults to
+	// TCPReadiness(Port), which services without a port cannot use, so they
+	// must set one. Services that accept connections before they can serve
+	// them, such as databases running init scripts, are better off with a
+	// LogReadiness check.
+	Readiness ReadinessCheck
+
+	// Timeout bounds how long to wait for the service to become ready.
+	// Defaults to DefaultStartTimeout.
+	Timeout time.Duration
+
+	container *App
+}
+
+// ContainerID returns the ID of the started service container.
+func (s *Service) ContainerID() string {
+	if s.container == nil {
+		return ""
+	}
+
+	return s.container.ContainerID
+}
+
+// HostPort returns the host port a container port of the started service is
+// published on.
+func (s *Service) HostPort(containerPort string) (string, error) {
+	if s.container == nil {
+		return "", fmt.Errorf("service %s has not been started", s.Name)
+	}
+
+	return s.container.HostPort(containerPort)
+}
+
+// Logs returns the logs of the started service container.
+func (s *Service) Logs() (string, error) {
+	if s.container == nil {
+		return "", fmt.Errorf("service %s has not been started", s.Name)
+	}
+
+	return s.container.Logs()
+}
+
+// StartService starts service on the app network, creating the network on
+// first use, waits for it to be ready and adds its connection details to
+// App.Env. Services must be started before the app, and are removed along
+// with the network by Destroy.
+func (a *App) StartService(service *Service) error {
+	if service.Name == "" || service.Image == "" {
+		return fmt.Errorf("service requires a name and an image")
+	}
+
+	readiness := service.Readiness
+	if readiness == nil {
+		if service.Port == "" {
+			return fmt.Errorf("service %s requires a port or a readiness check", service.Name)
+		}
+
+		readiness = TCPReadiness(service.Port)
+	}
+
+	runtime, err := a.containerRuntime()
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	if a.network == "" {
+		network := fmt.Sprintf("dagger-%s", utils.RandStringRunes(12))
+		err = runtime.CreateNetwork(ctx, network)
+		if err != nil {
+			return err
+		}
+		a.network = network
+	}
+
+	timeout := service.Timeout
+	if timeout == 0 {
+		timeout = DefaultStartTimeout
+	}
+
+	container := &App{
+		ImageName:   service.Image,
+		Env:         service.Env,
+		fixtureName: service.Name,
+		runtime:     runtime,
+	}
+
+	config := RunConfig{
+		Image:          service.Image,
+		Command:        service.Command,
+		Env:            service.Env,
+		Network:        a.network,
+		NetworkAliases: []string{service.Name},
+	}
+
+	if service.Port != "" {
+		config.Ports = []string{service.Port}
+	}
+
+	if configurer, ok := readiness.(runConfigurer); ok {
+		err = configurer.configure(container, &config)
+		if err != nil {
+			return err
+		}
+	}
+
+	container.ContainerID, err = runtime.Run(ctx, config)
+	if err != nil {
+		return fmt.Errorf("failed to run service %s from image %s: %w", service.Name, service.Image, err)
+	}
+	service.container = container
+	a.services = append(a.services, service)
+
+	container.ports, err = runtime.Ports(ctx, container.ContainerID)
+	if err != nil {
+		return fmt.Errorf("failed to get ports of service %s: %w", service.Name, err)
+	}
+
+	err = container.waitUntilReady(ctx, runtime, readiness, timeout, DefaultStartPollInterval)
+	if err != nil {
+		return err
+	}
+
+	if a.Env == nil {
+		a.Env = map[string]string{}
+	}
+
+	prefix := strings.Trim(envNamePattern.ReplaceAllString(strings.ToUpper(service.Name), "_"), "_")
+	a.Env[prefix+"_HOST"] = service.Name
+	if service.Port != "" {
+		a.Env[prefix+"_PORT"] = service.Port
+	}
+
+	for key, value := range service.AppEnv {
+		a.Env[key] = value
+	}
+
+	return nil
+}
+
+func (a *App) destroyServices(ctx context.Context, runtime ContainerRuntime) error {
+	for _, service := range a.services {
+		if service.container.logFollower != nil {
+			service.container.logFollower.Stop()
+		}
+
+		err := runtime.Remove(ctx, service.ContainerID())
+		if err != nil {
+			return fmt.Errorf("failed to remove service %s: %w", service.Name, err)
+		}
+	}
+
+	a.services = nil
+	return nil
+}